@@ -0,0 +1,99 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+	"image"
+	"io"
+	"strings"
+)
+
+// HasAlpha checks whether an image actually uses transparency, rather than
+// just having an alpha channel that's opaque throughout, so opaque images can
+// be written as JPEGs and transparent ones as PNGs or WebPs. SVGs are taken
+// to be transparent, as they are wherever nothing is drawn, and JPEGs never
+// are. PNGs and GIFs are checked in Go, anything else requires ImageMagick's
+// identify. Only the first frame or layer is looked at
+func HasAlpha(data io.Reader) (bool, error) {
+	o := &options{}
+
+	mimetype, src, err := readInput(data, o)
+	defer src.remove()
+	if err != nil { return false, err }
+
+	switch mimetype {
+	case "svg":
+		return true, nil
+	case "jpg":
+		return false, nil
+	case "png", "gif":
+		r, err := src.reader()
+		if err != nil { return false, err }
+		defer closeReader(r)
+
+		img, _, err := image.Decode(r)
+		if err != nil { return false, err }
+
+		return !isOpaque(img), nil
+	}
+
+	if !contains(magickInFormats, mimetype) {
+		return false, errors.New("unable to check the transparency of " + mimetype + " images")
+	}
+
+	cmd, args, err := findMagick("identify")
+	if err != nil {
+		return false, errors.New("HasAlpha requires ImageMagick to be installed for " + mimetype)
+	}
+
+	input := src.input()
+	if input == "-" { input = mimetype + ":-" }
+
+	args = append(args, "-format", "%[opaque]\n", input)
+
+	out, err := run(cmd, args, src, o)
+	if err != nil { return false, err }
+
+	// Every frame gets its own line, saying True or False depending on the
+	// version
+	opaque := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	return !strings.EqualFold(opaque, "true"), nil
+}
+
+// isOpaque checks whether every pixel of img is fully opaque
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff { return false }
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,139 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Formats img2webp is able to read frames from
+var img2webpFormats = []string{
+	"png", "jpg", "tiff", "webp",
+}
+
+// AnimateWebP encodes a sequence of frames as an animated WebP, showing each
+// frame for delayMs milliseconds and looping loop times (0 loops forever).
+// Every frame must have the same dimensions. img2webp (from libwebp) is used
+// if installed, otherwise ImageMagick's convert
+func AnimateWebP(frames []io.Reader, delayMs int, loop int, opts ...Option) (io.Reader, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("at least one frame is required")
+	}
+
+	if delayMs < 1 || loop < 0 {
+		return nil, errors.New("delay must be above 0 and loop can't be negative")
+	}
+
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	dir, err := os.MkdirTemp("", "imgconv-*")
+	if err != nil { return nil, err }
+	defer os.RemoveAll(dir)
+
+	// Both backends need the frames as files
+	var files []string
+	useImg2webp := true
+	fw, fh := -1, -1
+
+	for i, frame := range frames {
+		mimetype, src, err := readInput(frame, o)
+		if err != nil {
+			src.remove()
+			return nil, errors.New("frame " + strconv.Itoa(i) + ": " + err.Error())
+		}
+
+		// Frames whose size can't be probed are left for the backend to
+		// complain about
+		w, h, err := probeSize(mimetype, src, o)
+		if err == nil && fw == -1 {
+			fw, fh = w, h
+		} else if err == nil && (w != fw || h != fh) {
+			src.remove()
+			return nil, errors.New("frame " + strconv.Itoa(i) + " is " + strconv.Itoa(w) + "x" +
+				strconv.Itoa(h) + ", but earlier frames are " + strconv.Itoa(fw) + "x" + strconv.Itoa(fh))
+		}
+
+		if !contains(img2webpFormats, mimetype) { useImg2webp = false }
+
+		path := filepath.Join(dir, "frame-"+strconv.Itoa(i)+"."+mimetype)
+		err = writeSource(src, path)
+		src.remove()
+		if err != nil { return nil, err }
+
+		files = append(files, path)
+	}
+
+	out := filepath.Join(dir, "out.webp")
+
+	var cmd string
+	var args []string
+
+	if path, err := findProgram("img2webp"); err == nil && useImg2webp {
+		cmd = path
+		args = []string{
+			"-loop", strconv.Itoa(loop),
+			"-d", strconv.Itoa(delayMs),
+		}
+		args = append(args, files...)
+		args = append(args, "-o", out)
+	} else if path, sub, err := findMagick("convert"); err == nil {
+		// ImageMagick counts delays in ticks, so make a tick 1ms
+		cmd = path
+		args = append(sub,
+			"-delay", strconv.Itoa(delayMs) + "x1000",
+			"-loop", strconv.Itoa(loop),
+		)
+		args = append(args, files...)
+		args = append(args, "webp:"+out)
+	} else {
+		return nil, errors.New("AnimateWebP requires img2webp (from libwebp) or ImageMagick to be installed")
+	}
+
+	if _, err := run(cmd, args, nil, o); err != nil { return nil, err }
+
+	b, err := os.ReadFile(out)
+	if err != nil { return nil, err }
+
+	return bytes.NewReader(b), nil
+}
+
+// writeSource writes the entire input to a file at path
+func writeSource(src *source, path string) error {
+	r, err := src.reader()
+	if err != nil { return err }
+	defer closeReader(r)
+
+	file, err := os.Create(path)
+	if err != nil { return err }
+
+	_, err = io.Copy(file, r)
+	if cerr := file.Close(); err == nil { err = cerr }
+
+	return err
+}
@@ -0,0 +1,557 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Programs preinstalled on the system that are capable of supporting images
+type converter struct {
+	name       string   // Name of the program's executable
+	inFormats  []string // Supported input formats
+	outFormats []string // Supported output formats
+
+	// Builds the args to convert the image described by j
+	args func(j *job) []string
+
+	// Checks whether the converter can do everything j asks for, beyond
+	// supporting the formats. If nil, it can
+	supports func(j *job) bool
+
+	// Converters implemented in Go rather than as an external program set
+	// this, which is called in place of running anything
+	convert func(j *job, r io.Reader) ([]byte, error)
+
+	// Set for programs that can't read from stdin or write to stdout, which
+	// are given files instead
+	files bool
+
+	// Set for file programs that name their output after the input, in the
+	// directory of the output they're given
+	namesOutput bool
+
+	// Set for converters that never lose anything, even between lossy
+	// formats
+	lossless bool
+
+	// Checks whether the installed program at path can really convert
+	// between two formats, for programs whose support depends on how they
+	// were built. If nil, inFormats and outFormats are taken as they are
+	handles func(path string, from string, to string) bool
+}
+
+// job describes a single conversion, which converters build their args from
+type job struct {
+	formatIn  string
+	formatOut string
+	w         int
+	h         int
+	input     string // Path of the input file, or "-" for stdin
+	output    string // Path of the output file, for programs that need one
+	opts      *options
+
+	// Whether the input is a CMYK JPEG, and whether it embeds an ICC
+	// profile
+	cmyk       bool
+	iccProfile bool
+
+	// Intrinsic size of SVG inputs, 0 if unknown
+	svgW int
+	svgH int
+
+	// Overrides the density ImageMagick renders SVGs at, when retrying
+	density float64
+}
+
+// cmd is a converter that's been found able to do a job
+type cmd struct {
+	conv *converter
+	path string   // Full path of the executable
+	args []string // Args to run it with
+}
+
+var (
+	// Supported conversion programs, in order of preference
+	converters = []*converter{
+		goConverter,
+		svgConverter,
+
+		{
+			name: "rsvg-convert",
+			args: rsvgArgs,
+			supports: renderOnly,
+			inFormats:  []string{
+				"svg",
+			},
+			outFormats: []string{
+				"png", "pdf", "ps", "eps", "svg", "xml",
+			},
+		},
+
+		{
+			name: "inkscape",
+			args: inkscapeArgs,
+			supports: inkscapeSupports,
+			inFormats: []string{ "svg" },
+			outFormats: []string{
+				"png", "pdf", "ps",  "eps", "svg",
+			},
+		},
+
+		cjxlConverter,
+		djxlConverter,
+		opjCompressConverter,
+		opjDecompressConverter,
+		cwebpConverter,
+		icnsConverter,
+		jpegtranConverter,
+		vipsConverter,
+		texconvConverter,
+		toktxConverter,
+
+		magickConverter("convert"),
+		magickConverter("magick"),
+
+		ffmpegConverter,
+	}
+
+	// Formats ImageMagick is able to read and write, when built with every
+	// delegate. What the installed one can do is narrowed down by listing them
+	magickInFormats = []string{
+		"svg", "png", "xpm", "jxl", "jp2", "jpf",
+		"jpg", "gif", "webp","bmp", "ico", "bpg",
+		"dwg", "icns","heic","heif","hdr", "xcf",
+		"pat", "gbr", "tiff","pdf", "tga", "psd",
+		"dds",
+	}
+	magickOutFormats = []string{
+		"png", "xpm", "jxl", "jp2", "jpf", "gbr",
+		"jpg", "gif", "webp","bmp", "ico", "bpg",
+		"dwg", "icns","heic","heif","hdr", "xcf",
+		"pat", "tiff","tga", "png8",
+		"dds",
+	}
+
+	// Headerless pixel data ImageMagick can read, given its size. These are
+	// never detected, only used when given with WithInputFormat
+	rawFormats = []string{
+		"rgb", "rgba", "bgr", "bgra", "gray", "graya", "cmyk", "cmyka",
+	}
+
+	// Formats made of layers, which are flattened into a single image unless
+	// a specific layer is asked for
+	layeredFormats = []string{ "psd", "xcf" }
+
+	// Formats that can hold animations, the only ones WithLayers can be used
+	// with
+	animatedFormats = []string{ "gif", "webp" }
+
+	// Bits per channel formats can be written at with WithDepth. HDR always
+	// stores floating point, which keeps the precision of deeper images
+	depthFormats = map[string][]int{
+		"png":  { 8, 16 },
+		"tiff": { 8, 16, 32 },
+		"hdr":  { 16, 32 },
+	}
+
+	// These are swapped out in tests to fake which programs are installed
+	// and what they do when run
+	lookPath    = exec.LookPath
+	execCommand = exec.CommandContext
+)
+
+// The DPI SVGs are rendered at by default, where one user unit is one pixel
+const svgDPI = 96
+
+// getCmds finds every converter on the system able to do j, in order of
+// preference. Later ones are used as fallbacks if the first fails
+func getCmds(j *job) ([]cmd, error) {
+	var cmds []cmd
+
+	// Go through converters making sure they're in the PATH and support the
+	// requested image format
+	for _, conv := range converters {
+		if !contains(conv.inFormats, j.formatIn) || !contains(conv.outFormats, j.formatOut) {
+			continue
+		}
+
+		if conv.supports != nil && !conv.supports(j) {
+			continue
+		}
+
+		if conv.convert != nil {
+			cmds = append(cmds, cmd{ conv: conv })
+			continue
+		}
+
+		path, err := findProgram(conv.name)
+		if err != nil { continue }
+
+		if conv.handles != nil && !conv.handles(path, j.formatIn, j.formatOut) {
+			continue
+		}
+
+		cmds = append(cmds, cmd{
+			conv: conv,
+			path: path,
+			args: conv.args(j),
+		})
+	}
+
+	if len(cmds) == 0 {
+		err := errors.New("failed to find a suitable image conversion program on "+
+			"this machine to convert "+j.formatIn+" to "+j.formatOut)
+		return nil, err
+	}
+
+	return cmds, nil
+}
+
+// renderOnly is the supports func of converters that can only render and
+// resize
+func renderOnly(j *job) bool {
+	return !j.opts.needsMagick() && !j.opts.tunesJpeg(j.formatOut)
+}
+
+// inkscapeSupports checks whether Inkscape can do j, which is anything
+// renderOnly allows besides setting the page size
+func inkscapeSupports(j *job) bool {
+	return renderOnly(j) && j.opts.pageUnit == ""
+}
+
+// stretchArgs returns the ImageMagick args stretching the levels of the image
+// as asked for with WithNormalize and friends
+func stretchArgs(o *options) []string {
+	switch {
+	case !o.stretch:
+		return nil
+	case o.stretchBlack == 0 && o.stretchWhite == 0:
+		return []string{ "-auto-level" }
+	case o.stretchBlack == 2 && o.stretchWhite == 1:
+		return []string{ "-normalize" }
+	}
+
+	return []string{
+		"-contrast-stretch", formatFloat(o.stretchBlack) + "%x" + formatFloat(o.stretchWhite) + "%",
+	}
+}
+
+// patternArgs returns the ImageMagick args drawing the pattern of
+// WithBackgroundPattern behind the image. The pattern is drawn over a copy of
+// the image, so it's the same size, which then goes underneath it
+func patternArgs(spec string) []string {
+	if spec == "" { return nil }
+
+	draw := []string{ "-tile", "pattern:checkerboard", "-draw", "color 0,0 reset" }
+	if spec != "checkerboard" {
+		colors := strings.Split(strings.TrimPrefix(spec, "gradient:"), "-")
+		draw = []string{
+			"-alpha", "off",
+			"-sparse-color", "Barycentric", "0,0 " + colors[0] + " 0,%h " + colors[1],
+		}
+	}
+
+	args := append([]string{ "(", "+clone" }, draw...)
+	return append(args, ")", "+swap", "-composite")
+}
+
+// formatFloat formats f for use as an argument, without needless zeros
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func rsvgArgs(j *job) []string {
+	args := []string{
+		"-f", j.formatOut,
+	}
+
+	// The width and height take units as well, which sizes the image in the
+	// same terms as the page
+	if j.opts.pageUnit != "" {
+		w := formatFloat(j.opts.pageW) + j.opts.pageUnit
+		h := formatFloat(j.opts.pageH) + j.opts.pageUnit
+
+		args = append(args,
+			"--page-width", w,
+			"--page-height", h,
+			"-w", w,
+			"-h", h,
+			"--keep-aspect-ratio",
+		)
+	} else if j.w > 0 && j.h > 0 {
+		args = append(args,
+			"-w", strconv.Itoa(j.w),
+			"-h", strconv.Itoa(j.h),
+		)
+
+		// rsvg-convert stretches to both unless told otherwise
+		if j.opts.resize != ResizeStretch {
+			args = append(args, "--keep-aspect-ratio")
+		}
+	} else if j.opts.zoom > 0 {
+		args = append(args, "--zoom", formatFloat(j.opts.zoom))
+	}
+
+	// rsvg-convert reads from stdin unless given a file
+	if j.input != "-" {
+		args = append(args, j.input)
+	}
+
+	return args
+}
+
+func inkscapeArgs(j *job) []string {
+	// Inkscape is told to read from stdin with -p, otherwise it takes the input
+	// file as an argument
+	in := "-p"
+	if j.input != "-" { in = j.input }
+
+	args := []string{
+		in,
+		"--export-type="+j.formatOut,
+		"--export-filename", "-",
+	}
+
+	// Inkscape doesn't have support for using -1 as regular resolution, so add
+	// in width and height if the resolution asked for is 0 or greater
+	if j.w > 0 && j.h > 0 {
+		// Inkscape stretches to both, so it's given the size the image fits
+		// at instead, if it's known
+		w, h := j.w, j.h
+		if j.opts.resize != ResizeStretch && j.svgW > 0 && j.svgH > 0 {
+			w, h = fitSize(j.svgW, j.svgH, j.w, j.h)
+		}
+
+		args = append(args,
+			"-w", strconv.Itoa(w),
+			"-h", strconv.Itoa(h),
+		)
+	} else if j.opts.zoom > 0 {
+		args = append(args, "--export-dpi", formatFloat(svgDPI*j.opts.zoom))
+	}
+
+	return args
+}
+
+// magickArgs builds the arguments for ImageMagick's convert to read the input
+// of j and write it resized to output, which can be prefixed with a format
+// (eg: png:-)
+func magickArgs(j *job, output string) []string {
+	var args []string
+
+	for _, define := range j.opts.defines {
+		args = append(args, "-define", define)
+	}
+
+	args = append(args, magickLimits(j.opts)...)
+
+	if j.formatIn == "svg" {
+		if density := svgDensity(j); density > 0 {
+			args = append(args, "-density", formatFloat(density))
+		}
+	}
+
+	// Raw pixels have no header saying how they're laid out
+	if contains(rawFormats, j.formatIn) {
+		args = append(args,
+			"-size", strconv.Itoa(j.opts.inputW) + "x" + strconv.Itoa(j.opts.inputH),
+			"-depth", "8",
+		)
+	}
+
+	// An explicit input format is passed on as a prefix, so ImageMagick
+	// doesn't try to guess
+	input := j.input
+	if j.opts.inputFormat != "" {
+		input = j.opts.inputFormat + ":" + input
+	}
+
+	// A single page, frame or layer is picked with ImageMagick's read
+	// modifier, which only works on files, so the input is always spilled to
+	// disk in that case
+	if j.opts.selectFrame {
+		input += "[" + strconv.Itoa(j.opts.frame) + "]"
+	}
+
+	args = append(args,
+		"-background", "none",
+		input,
+	)
+
+	if !j.opts.selectFrame && contains(layeredFormats, j.formatIn) {
+		args = append(args, "-flatten")
+	}
+
+	args = append(args, cmykArgs(j)...)
+
+	// Layer methods other than these two expect whole frames, as do the
+	// rotating and resizing that follow
+	if j.opts.layers != "" {
+		if j.opts.layers == "Dispose" {
+			args = append(args, "-layers", "Dispose")
+		} else {
+			args = append(args, "-coalesce")
+		}
+	}
+
+	if j.opts.rotate != 0 {
+		args = append(args, "-rotate", strconv.Itoa(j.opts.rotate))
+	}
+
+	// +repage drops the offset of the trimmed area from the canvas, otherwise
+	// later steps would still see the original size
+	if j.opts.trim {
+		if j.opts.fuzz > 0 {
+			args = append(args, "-fuzz", formatFloat(j.opts.fuzz)+"%")
+		}
+
+		args = append(args, "-trim", "+repage")
+	}
+
+	args = append(args, stretchArgs(j.opts)...)
+
+	// Like the density, only resize if a resolution was actually asked for.
+	// When filling, the image is resized to cover the resolution and the
+	// excess is cropped off, and when padding it's resized to fit and the
+	// canvas is extended to the resolution. Either way the gravity decides
+	// where the image sits
+	res := strconv.Itoa(j.w)+"x"+strconv.Itoa(j.h)
+	if j.w > 0 && j.h > 0 {
+		if j.opts.filter != "" {
+			args = append(args, "-filter", j.opts.filter)
+		}
+
+		// ImageMagick takes RGB to mean linear RGB
+		if j.opts.linearResize {
+			args = append(args, "-colorspace", "RGB")
+		}
+
+		switch j.opts.resize {
+		case ResizeFill:
+			args = append(args, "-resize", res+"^")
+		case ResizeStretch:
+			args = append(args, "-resize", res+"!")
+		default:
+			args = append(args, "-resize", res)
+		}
+
+		if j.opts.linearResize {
+			args = append(args, "-colorspace", "sRGB")
+		}
+
+		if j.opts.fillsOrPads() {
+			args = append(args,
+				"-gravity", j.opts.gravityName(),
+				"-extent", res,
+			)
+		}
+
+		// The square's side is the larger of the resolution, which is what
+		// the image was fit to
+		if j.opts.squarePad {
+			side := j.w
+			if j.h > side { side = j.h }
+			square := strconv.Itoa(side) + "x" + strconv.Itoa(side)
+
+			args = append(args,
+				"-background", j.opts.squareBg,
+				"-gravity", "Center",
+				"-extent", square,
+			)
+		}
+	}
+
+	args = append(args, patternArgs(j.opts.bgPattern)...)
+
+	// Density given after the input sets the resolution written to the
+	// output, rather than the one the input is read at
+	if j.opts.dpi > 0 {
+		args = append(args,
+			"-units", "PixelsPerInch",
+			"-density", formatFloat(j.opts.dpi),
+		)
+	}
+
+	// Dithering is a setting, so it has to come before the colors are
+	// reduced
+	switch j.opts.dither {
+	case "":
+	case "None":
+		args = append(args, "+dither")
+	default:
+		args = append(args, "-dither", j.opts.dither)
+	}
+
+	if j.opts.colors > 0 {
+		args = append(args, "-colors", strconv.Itoa(j.opts.colors))
+	}
+
+	if j.opts.depth > 0 {
+		args = append(args, "-depth", strconv.Itoa(j.opts.depth))
+	}
+
+	// Optimizing has to come last, as anything done to the frames afterwards
+	// would undo it
+	if j.opts.layers != "" && j.opts.layers != "Coalesce" && j.opts.layers != "Dispose" {
+		args = append(args, "-layers", j.opts.layers)
+	}
+
+	if j.opts.comment != "" {
+		args = append(args, "-set", "comment", magickComment(j.opts.comment))
+	}
+
+	if j.opts.compression != "" {
+		args = append(args, "-compress", j.opts.compression)
+	}
+
+	if j.opts.quality > 0 {
+		args = append(args, "-quality", strconv.Itoa(j.opts.quality))
+	}
+
+	if j.opts.effort > 0 && j.formatOut == "jxl" {
+		args = append(args, "-define", "jxl:effort="+strconv.Itoa(j.opts.effort))
+	}
+
+	if f := blockFormats[j.opts.blockFormat]; f.magick != "" && j.formatOut == "dds" {
+		args = append(args, "-define", "dds:compression="+f.magick)
+	}
+
+	if j.opts.hasWebpMethod && j.formatOut == "webp" {
+		args = append(args, "-define", "webp:method="+strconv.Itoa(j.opts.webpMethod))
+	}
+
+	if j.opts.optimizeCoding && j.formatOut == "jpg" {
+		args = append(args, "-define", "jpeg:optimize-coding=true")
+	}
+
+	if j.opts.restartInterval > 0 && j.formatOut == "jpg" {
+		args = append(args, "-define", "jpeg:restart-interval="+strconv.Itoa(j.opts.restartInterval))
+	}
+
+	return append(args, output)
+}
@@ -0,0 +1,139 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMissingProgram(t *testing.T) {
+	fakePrograms(t, map[string]string{ "convert": catScript })
+
+	var info ConvertInfo
+	r, err := Convert(strings.NewReader(testSVG), -1, -1, "png", WithInfo(&info))
+	if err != nil { t.Fatal(err) }
+
+	out, _ := ioutil.ReadAll(r)
+	if string(out) != testSVG { t.Errorf("got %q, want the output of convert", out) }
+	if info.Backend != "convert" { t.Errorf("converted with %q, want convert", info.Backend) }
+}
+
+func TestNoProgram(t *testing.T) {
+	fakePrograms(t, map[string]string{})
+
+	_, err := Convert(strings.NewReader(testSVG), -1, -1, "png")
+	if err == nil || !strings.Contains(err.Error(), "failed to find a suitable") {
+		t.Fatalf("got %v, want no program to be found", err)
+	}
+}
+
+func TestFailingBackend(t *testing.T) {
+	fakePrograms(t, map[string]string{
+		"rsvg-convert": "echo rsvg broke >&2; exit 1",
+	})
+
+	_, err := Convert(strings.NewReader(testSVG), -1, -1, "png")
+
+	var convErr *ConvertError
+	if !errors.As(err, &convErr) { t.Fatalf("got %v, want a ConvertError", err) }
+	if !strings.Contains(convErr.Stderr, "rsvg broke") {
+		t.Errorf("stderr is %q, want what rsvg-convert wrote", convErr.Stderr)
+	}
+	if convErr.From != "svg" || convErr.To != "png" {
+		t.Errorf("converting %s to %s, want svg to png", convErr.From, convErr.To)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	fakePrograms(t, map[string]string{
+		"rsvg-convert": "echo rsvg broke >&2; exit 1",
+		"convert":      catScript,
+	})
+
+	var info ConvertInfo
+	r, err := Convert(strings.NewReader(testSVG), -1, -1, "png", WithInfo(&info))
+	if err != nil { t.Fatal(err) }
+
+	out, _ := ioutil.ReadAll(r)
+	if string(out) != testSVG { t.Errorf("got %q, want the output of convert", out) }
+	if info.Backend != "convert" { t.Errorf("fell back to %q, want convert", info.Backend) }
+}
+
+func TestEmptyOutput(t *testing.T) {
+	fakePrograms(t, map[string]string{ "rsvg-convert": "cat >/dev/null" })
+
+	_, err := Convert(strings.NewReader(testSVG), -1, -1, "png")
+	if !errors.Is(err, ErrEmptyOutput) { t.Fatalf("got %v, want ErrEmptyOutput", err) }
+}
+
+func TestEmptyOutputFallback(t *testing.T) {
+	fakePrograms(t, map[string]string{
+		"rsvg-convert": "cat >/dev/null",
+		"convert":      catScript,
+	})
+
+	var info ConvertInfo
+	r, err := Convert(strings.NewReader(testSVG), -1, -1, "png", WithInfo(&info))
+	if err != nil { t.Fatal(err) }
+
+	out, _ := ioutil.ReadAll(r)
+	if string(out) != testSVG { t.Errorf("got %q, want the output of convert", out) }
+	if info.Backend != "convert" { t.Errorf("fell back to %q, want convert", info.Backend) }
+}
+
+func TestDepthNeedsMagick(t *testing.T) {
+	script, runs := loggingScript(t, testPNG(16, 8))
+	fakePrograms(t, map[string]string{
+		"rsvg-convert": catScript,
+		"convert":      script,
+	})
+
+	var info ConvertInfo
+	_, err := Convert(strings.NewReader(testSVG), -1, -1, "png", WithDepth(16), WithInfo(&info))
+	if err != nil { t.Fatal(err) }
+
+	if info.Backend != "convert" { t.Errorf("converted with %q, want convert", info.Backend) }
+
+	all := runs()
+	if run := all[len(all)-1]; !strings.Contains(run, "-depth 16") {
+		t.Errorf("convert was run with %q, want -depth 16", run)
+	}
+}
+
+func TestSvgIdentity(t *testing.T) {
+	fakePrograms(t, map[string]string{
+		"rsvg-convert": "echo rsvg-convert was run >&2; exit 1",
+		"convert":      "echo convert was run >&2; exit 1",
+	})
+
+	// Written oddly, so anything that parses and writes it back out shows
+	in := "<?xml version='1.0'?>\n<svg  xmlns='http://www.w3.org/2000/svg' width='16' height='8' >\n\t<rect width='16' height='8'/><!-- kept -->\n</svg>\n"
+
+	r, err := Convert(strings.NewReader(in), -1, -1, "svg")
+	if err != nil { t.Fatal(err) }
+
+	out, _ := ioutil.ReadAll(r)
+	if string(out) != in { t.Errorf("got %q, want the input byte for byte", out) }
+}
@@ -0,0 +1,106 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConvertDir converts every image in srcDir into destDir, which is created if
+// it doesn't exist. Each output is named after its input with the extension
+// swapped for format (logo.svg becomes logo.png), unless a different naming
+// scheme is given with WithNameFunc. If two inputs would be written to the
+// same file nothing is converted and an error is returned. Files that aren't
+// images are left out, in which case the outputs are still returned along
+// with a *SkippedError listing what was left out. The paths of the outputs
+// are returned in order of their input's names
+func ConvertDir(srcDir string, destDir string, w int, h int, format string, opts ...Option) ([]string, error) {
+	if err := checkRes(w, h); err != nil { return nil, err }
+
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	format, err = o.outputFormat(format, "")
+	if err != nil { return nil, err }
+
+	// ReadDir already sorts by filename
+	entries, err := os.ReadDir(srcDir)
+	if err != nil { return nil, err }
+
+	var srcs, dests []string
+	skipped := &SkippedError{}
+	names   := make(map[string]string)
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() { continue }
+
+		src := filepath.Join(srcDir, entry.Name())
+		if !isImage(src) {
+			skipped.Files = append(skipped.Files, src)
+			continue
+		}
+
+		dest := filepath.Join(destDir, outputName(src, format, o))
+		if other, ok := names[dest]; ok {
+			return nil, errors.New("both " + other + " and " + src + " would be converted to " + dest)
+		}
+		names[dest] = src
+
+		srcs  = append(srcs, src)
+		dests = append(dests, dest)
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil { return nil, err }
+
+	for i := range srcs {
+		if err := ConvertFile(srcs[i], dests[i], w, h, format, opts...); err != nil {
+			return dests[:i], err
+		}
+	}
+
+	if len(skipped.Files) > 0 {
+		return dests, skipped
+	}
+
+	return dests, nil
+}
+
+// outputName returns the file name the image at src is converted to
+func outputName(src string, format string, o *options) string {
+	if o.nameFunc != nil { return o.nameFunc(src) }
+
+	base := filepath.Base(src)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "." + format
+}
+
+// isImage checks whether the file at path is an image
+func isImage(path string) bool {
+	f, err := os.Open(path)
+	if err != nil { return false }
+	defer f.Close()
+
+	_, err = GetType(f)
+	return err == nil
+}
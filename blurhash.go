@@ -0,0 +1,163 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// The size images are scaled down to before working out their BlurHash. The
+// hash only holds a handful of cosine components, so more pixels than this
+// just take longer without changing the result
+const blurHashRes = 64
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash computes the BlurHash (see blurha.sh) of an image, a short string
+// that can be drawn as a blurry placeholder while the real image loads.
+// componentsX and componentsY (1 to 9 each) are how much detail it keeps
+// across and down; 4 and 3 are typical for landscape images. Transparency is
+// ignored
+func BlurHash(data io.Reader, componentsX int, componentsY int, opts ...Option) (string, error) {
+	if componentsX < 1 || componentsX > 9 || componentsY < 1 || componentsY > 9 {
+		return "", errors.New("blurhash components must be between 1 and 9")
+	}
+
+	pix, w, h, err := ConvertRaw(data, blurHashRes, blurHashRes, opts...)
+	if err != nil { return "", fmt.Errorf("blurhash: unable to decode image: %w", err) }
+	if w < 1 || h < 1 { return "", errors.New("blurhash: image is empty") }
+
+	// Converting to linear light once up front saves doing it for every
+	// component
+	linear := make([]float64, len(pix))
+	for i, v := range pix {
+		linear[i] = srgbToLinear(v)
+	}
+
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for y := 0; y < componentsY; y++ {
+		for x := 0; x < componentsX; x++ {
+			factors = append(factors, blurHashFactor(linear, w, h, x, y))
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((componentsX-1)+(componentsY-1)*9, 1))
+
+	ac := factors[1:]
+
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			for _, c := range f {
+				actualMax = math.Max(actualMax, math.Abs(c))
+			}
+		}
+
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantised+1) / 166
+		hash.WriteString(encode83(quantised, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encode83(linearToSrgb(dc[0])<<16 | linearToSrgb(dc[1])<<8 | linearToSrgb(dc[2]), 4))
+
+	for _, f := range ac {
+		value := 0
+		for _, c := range f {
+			q := math.Floor(signPow(c/maxValue, 0.5)*9 + 9.5)
+			value = value*19 + int(math.Max(0, math.Min(18, q)))
+		}
+
+		hash.WriteString(encode83(value, 2))
+	}
+
+	return hash.String(), nil
+}
+
+// blurHashFactor is the strength of the cosine component x, y in each channel
+// of an image of RGBA pixels in linear light
+func blurHashFactor(linear []float64, w int, h int, x int, y int) [3]float64 {
+	var f [3]float64
+
+	for py := 0; py < h; py++ {
+		cy := math.Cos(math.Pi * float64(y) * float64(py) / float64(h))
+
+		for px := 0; px < w; px++ {
+			basis := cy * math.Cos(math.Pi*float64(x)*float64(px)/float64(w))
+
+			i := (py*w + px) * 4
+			f[0] += basis * linear[i]
+			f[1] += basis * linear[i+1]
+			f[2] += basis * linear[i+2]
+		}
+	}
+
+	norm := 2.0
+	if x == 0 && y == 0 { norm = 1 }
+
+	scale := norm / float64(w*h)
+	for i := range f {
+		f[i] *= scale
+	}
+
+	return f
+}
+
+func srgbToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 { return f / 12.92 }
+
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(f float64) int {
+	f = math.Max(0, math.Min(1, f))
+	if f <= 0.0031308 { return int(math.Round(f * 12.92 * 255)) }
+
+	return int(math.Round((1.055*math.Pow(f, 1/2.4) - 0.055) * 255))
+}
+
+// signPow raises the magnitude of f to exp, keeping its sign
+func signPow(f float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(f), exp), f)
+}
+
+// encode83 writes value as length digits of the base 83 BlurHash uses
+func encode83(value int, length int) string {
+	b := make([]byte, length)
+
+	for i := length - 1; i >= 0; i-- {
+		b[i] = base83[value%83]
+		value /= 83
+	}
+
+	return string(b)
+}
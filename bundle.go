@@ -0,0 +1,149 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BundleSizes writes the results of ConvertMultiSize to w as a zip archive,
+// for sending them over the network in one go. Entries are named after their
+// size and format (eg: "64.png"), in order of size. The readers are read to
+// the end
+func BundleSizes(w io.Writer, images map[int]io.Reader, format string) error {
+	sizes := make([]int, 0, len(images))
+	for size := range images {
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+
+	entries := make([]bundleEntry, len(sizes))
+	for i, size := range sizes {
+		entries[i] = bundleEntry{ strconv.Itoa(size) + "." + format, images[size] }
+	}
+
+	return writeBundle(w, entries)
+}
+
+// BundleFormats is BundleSizes for the results of ConvertMultiFormat, named
+// name with the format as the extension (eg: "logo.webp"), in order of format
+func BundleFormats(w io.Writer, images map[string]io.Reader, name string) error {
+	formats := make([]string, 0, len(images))
+	for format := range images {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	entries := make([]bundleEntry, len(formats))
+	for i, format := range formats {
+		entries[i] = bundleEntry{ name + "." + format, images[format] }
+	}
+
+	return writeBundle(w, entries)
+}
+
+// BundleFrames is BundleSizes for the results of Frames, named after their
+// index, padded so they sort in order (eg: "frame-007.png")
+func BundleFrames(w io.Writer, frames []Frame) error {
+	digits := len(strconv.Itoa(len(frames) - 1))
+
+	entries := make([]bundleEntry, len(frames))
+	for i, f := range frames {
+		index := strconv.Itoa(f.Index)
+		for len(index) < digits {
+			index = "0" + index
+		}
+
+		entries[i] = bundleEntry{ "frame-" + index + ".png", bytes.NewReader(f.Image) }
+	}
+
+	return writeBundle(w, entries)
+}
+
+// BundleFiles is BundleSizes for files that have been written to dir, such
+// as the paths GenerateIconSet returns, named by their path within dir. Paths
+// outside of dir are an error
+func BundleFiles(w io.Writer, dir string, paths []string) error {
+	zw := zip.NewWriter(w)
+
+	for _, path := range paths {
+		name, err := filepath.Rel(dir, path)
+		if err != nil { return err }
+		name = filepath.ToSlash(name)
+
+		// Entries outside the archive's root would be extracted outside of
+		// wherever it's extracted to
+		if name == ".." || strings.HasPrefix(name, "../") || filepath.IsAbs(name) {
+			return errors.New(path + " isn't within " + dir)
+		}
+
+		f, err := os.Open(path)
+		if err != nil { return err }
+
+		err = writeEntry(zw, bundleEntry{ name, f })
+		f.Close()
+		if err != nil { return err }
+	}
+
+	return zw.Close()
+}
+
+// bundleEntry is a file to be written to a bundle
+type bundleEntry struct {
+	name string
+	r    io.Reader
+}
+
+// writeBundle writes entries to w as a zip archive
+func writeBundle(w io.Writer, entries []bundleEntry) error {
+	zw := zip.NewWriter(w)
+
+	for _, entry := range entries {
+		if err := writeEntry(zw, entry); err != nil { return err }
+	}
+
+	return zw.Close()
+}
+
+// writeEntry adds entry to zw. Most formats are compressed already, so only
+// SVGs are compressed any further
+func writeEntry(zw *zip.Writer, entry bundleEntry) error {
+	method := zip.Store
+	if strings.HasSuffix(entry.name, ".svg") { method = zip.Deflate }
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:   entry.name,
+		Method: method,
+	})
+	if err != nil { return err }
+
+	_, err = io.Copy(fw, entry.r)
+	return err
+}
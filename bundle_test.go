@@ -0,0 +1,71 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundleFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "icons"), 0755); err != nil { t.Fatal(err) }
+
+	paths := []string{ filepath.Join(dir, "a.png"), filepath.Join(dir, "icons", "b.png") }
+	for _, path := range paths {
+		if err := os.WriteFile(path, testPNG(8, 8), 0644); err != nil { t.Fatal(err) }
+	}
+
+	var b bytes.Buffer
+	if err := BundleFiles(&b, dir, paths); err != nil { t.Fatal(err) }
+
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil { t.Fatal(err) }
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+
+	if len(names) != 2 || names[0] != "a.png" || names[1] != "icons/b.png" {
+		t.Errorf("got entries %v, want a.png and icons/b.png", names)
+	}
+}
+
+func TestBundleFilesOutside(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "out")
+	if err := os.MkdirAll(dir, 0755); err != nil { t.Fatal(err) }
+
+	outside := filepath.Join(root, "secret.png")
+	if err := os.WriteFile(outside, testPNG(8, 8), 0644); err != nil { t.Fatal(err) }
+
+	for _, path := range []string{ outside, root } {
+		if err := BundleFiles(ioutil.Discard, dir, []string{ path }); err == nil {
+			t.Errorf("%s was bundled from outside of %s", path, dir)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"sort"
+	"strings"
+)
+
+// Every external program imgconv can use, along with the flag that makes it
+// print its version
+var programs = []struct {
+	name        string
+	versionFlag string
+}{
+	{ "rsvg-convert", "--version" },
+	{ "inkscape",     "--version" },
+	{ "convert",      "-version" },
+	{ "magick",       "-version" },
+	{ "identify",     "-version" },
+	{ "montage",      "-version" },
+	{ "img2webp",     "-version" },
+	{ "cjxl",         "--version" },
+	{ "djxl",         "--version" },
+	{ "ffmpeg",       "-version" },
+	{ "jpegtran",     "-version" },
+	{ "cwebp",        "-version" },
+	{ "toktx",        "--version" },
+
+	// OpenJPEG's tools have no way of printing their version alone
+	{ "opj_compress",   "" },
+	{ "opj_decompress", "" },
+	{ "texconv",        "" },
+
+	// libvips' tools print the version of the library
+	{ "vipsthumbnail", "--vips-version" },
+}
+
+// Report describes what the system imgconv is running on is able to do, see
+// Capabilities
+type Report struct {
+	// Every external program imgconv can use, whether it's installed or not
+	Programs []ProgramInfo
+
+	// The formats each input format can be converted to, by the built-in
+	// converters or the installed programs, eg: Conversions["svg"] might be
+	// []string{ "pdf", "png", "svg" }
+	Conversions map[string][]string
+}
+
+// ProgramInfo describes an external program in a Report
+type ProgramInfo struct {
+	Name    string
+	Path    string // Full path of the executable, "" if it isn't installed
+	Version string // First line of its version output, "" if unknown
+}
+
+// Capabilities checks which programs are installed and what they're able to
+// convert, for logging at startup or failing early on a misconfigured system.
+// Every installed program is run to get its version the first time (and
+// ImageMagick to list the formats it was built with), so this isn't free
+// unless WarmUp was called
+func Capabilities() Report {
+	r := Report{ Conversions: make(map[string][]string) }
+
+	for _, p := range programs {
+		info := ProgramInfo{ Name: p.name }
+
+		if path, err := findProgram(p.name); err == nil {
+			info.Path = path
+			info.Version, _ = cachedVersion(path, p.versionFlag)
+		}
+
+		r.Programs = append(r.Programs, info)
+	}
+
+	for _, conv := range converters {
+		path := r.path(conv.name)
+		if conv.convert == nil && path == "" { continue }
+
+		for _, from := range conv.inFormats {
+			for _, to := range conv.outFormats {
+				if conv.handles != nil && !conv.handles(path, from, to) { continue }
+
+				if !contains(r.Conversions[from], to) {
+					r.Conversions[from] = append(r.Conversions[from], to)
+				}
+			}
+		}
+	}
+
+	for _, to := range r.Conversions {
+		sort.Strings(to)
+	}
+
+	return r
+}
+
+// Installed checks whether the program called name was found
+func (r Report) Installed(name string) bool {
+	return r.path(name) != ""
+}
+
+// path returns where the program called name was found, "" if it wasn't
+func (r Report) path(name string) string {
+	for _, p := range r.Programs {
+		if p.Name == name { return p.Path }
+	}
+
+	return ""
+}
+
+// CanConvert checks whether images can be converted from one format to
+// another. Some options may still need a specific program, such as
+// ImageMagick for cropping
+func (r Report) CanConvert(from string, to string) bool {
+	return contains(r.Conversions[from], to)
+}
+
+// WhyCannotConvert is CanConvert, along with the reason when it can't, for
+// showing what to do about it: no backend at all knows one of the formats,
+// the backends that can do the conversion need to be installed (eg: "install
+// rsvg-convert, inkscape, convert or magick"), or the installed ones were
+// built without support for it. The reason is empty when it can convert
+func (r Report) WhyCannotConvert(from string, to string) (bool, string) {
+	if r.CanConvert(from, to) { return true, "" }
+
+	var readable, writable bool
+	var missing, unsupported []string
+
+	for _, conv := range converters {
+		in, out := contains(conv.inFormats, from), contains(conv.outFormats, to)
+		readable = readable || in
+		writable = writable || out
+
+		if !in || !out || contains(missing, conv.name) { continue }
+
+		if r.path(conv.name) == "" {
+			missing = append(missing, conv.name)
+		} else {
+			unsupported = append(unsupported, conv.name)
+		}
+	}
+
+	switch {
+	case !readable:
+		return false, "no backend can read " + from
+	case !writable:
+		return false, "no backend can write " + to
+	case len(unsupported) > 0 && len(missing) == 0:
+		return false, strings.Join(unsupported, ", ") + " can't convert " + from + " to " + to +
+			" as built, it may be missing a library for one of the formats"
+	case len(missing) > 0:
+		return false, "install " + orList(missing) + " to convert " + from + " to " + to
+	}
+
+	return false, "converting " + from + " to " + to + " isn't supported"
+}
+
+// orList joins items as "a, b or c"
+func orList(items []string) string {
+	if len(items) == 1 { return items[0] }
+
+	return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+}
+
+// programVersion returns the first line a program prints when asked for its
+// version, or nothing if it has no flag for it
+func programVersion(path string, flag string) (string, error) {
+	if flag == "" { return "", nil }
+
+	out, err := run(path, []string{ flag }, nil, &options{})
+	if err != nil { return "", err }
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" { return line, nil }
+	}
+
+	return "", nil
+}
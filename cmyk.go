@@ -0,0 +1,137 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Where sRGB ICC profiles are commonly installed
+var srgbProfilePaths = []string{
+	"/usr/share/color/icc/colord/sRGB.icc",
+	"/usr/share/color/icc/sRGB.icc",
+	"/usr/share/color/icc/ghostscript/srgb.icc",
+	"/usr/share/ghostscript/iccprofiles/srgb.icc",
+	"/usr/local/share/color/icc/sRGB.icc",
+}
+
+var (
+	srgbProfileOnce sync.Once
+	srgbProfilePath string
+)
+
+// srgbProfile returns the path of an sRGB ICC profile on the system, "" if
+// there's none
+func srgbProfile() string {
+	srgbProfileOnce.Do(func() {
+		for _, path := range srgbProfilePaths {
+			if _, err := os.Stat(path); err == nil {
+				srgbProfilePath = path
+				return
+			}
+		}
+	})
+
+	return srgbProfilePath
+}
+
+// cmykArgs returns the ImageMagick args converting a CMYK input to sRGB,
+// which otherwise comes out with wrong (often inverted) colors. An embedded
+// profile can only be honored by converting to an sRGB profile, which is used
+// if there's one on the system
+func cmykArgs(j *job) []string {
+	if !j.cmyk { return nil }
+
+	if profile := srgbProfile(); j.iccProfile && profile != "" {
+		return []string{ "-profile", profile }
+	}
+
+	return []string{ "-colorspace", "sRGB" }
+}
+
+// jpegColor reads the markers of a JPEG up to its frame header, reporting
+// whether it's CMYK (or YCCK, which is CMYK as well) and whether it has an
+// embedded ICC profile
+func jpegColor(r io.Reader) (cmyk bool, icc bool, err error) {
+	br := bufio.NewReader(r)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil { return false, false, err }
+	if soi != [2]byte{ 0xff, 0xd8 } {
+		return false, false, errors.New("not a JPEG")
+	}
+
+	for {
+		// Markers can be padded with any number of 0xff
+		b, err := br.ReadByte()
+		if err != nil { return false, false, err }
+		if b != 0xff { return false, false, errors.New("invalid JPEG marker") }
+
+		marker := byte(0xff)
+		for marker == 0xff {
+			marker, err = br.ReadByte()
+			if err != nil { return false, false, err }
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(br, size[:]); err != nil { return false, false, err }
+
+		n := int(binary.BigEndian.Uint16(size[:])) - 2
+		if n < 0 { return false, false, errors.New("invalid JPEG segment") }
+
+		switch {
+		// Start of frame, except DHT, JPG and DAC which share the range.
+		// The component count comes after the precision and size
+		case marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc:
+			var frame [6]byte
+			if _, err := io.ReadFull(br, frame[:]); err != nil { return false, false, err }
+
+			return frame[5] == 4, icc, nil
+
+		case marker == 0xe2:
+			sig := []byte("ICC_PROFILE\x00")
+			if head, err := br.Peek(len(sig)); err == nil && bytes.Equal(head, sig) {
+				icc = true
+			}
+		}
+
+		if _, err := br.Discard(n); err != nil { return false, false, err }
+	}
+}
+
+// jpegColorOf is jpegColor for the input of a conversion. Not knowing is
+// taken as not being CMYK
+func jpegColorOf(src *source) (bool, bool) {
+	r, err := src.peek()
+	if err != nil { return false, false }
+	defer closeReader(r)
+
+	cmyk, icc, _ := jpegColor(r)
+	return cmyk, icc
+}
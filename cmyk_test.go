@@ -0,0 +1,114 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+// cmykJPEG returns an 8x8 CMYK JPEG as written by Adobe software, with an
+// APP14 marker and four components, every one of them a flat block
+func cmykJPEG() []byte {
+	var b bytes.Buffer
+
+	b.Write([]byte{ 0xff, 0xd8 })
+
+	// APP14, with no transform as the components are CMYK rather than YCCK
+	b.Write([]byte{ 0xff, 0xee, 0x00, 0x0e })
+	b.WriteString("Adobe")
+	b.Write([]byte{ 0x00, 0x64, 0x00, 0x00, 0x00, 0x00, 0x00 })
+
+	// A quantization table of all 1s
+	b.Write([]byte{ 0xff, 0xdb, 0x00, 0x43, 0x00 })
+	b.Write(bytes.Repeat([]byte{ 1 }, 64))
+
+	// Baseline frame header, 8x8 with 4 components
+	b.Write([]byte{ 0xff, 0xc0, 0x00, 0x14, 8, 0, 8, 0, 8, 4 })
+	for id := byte(1); id <= 4; id++ {
+		b.Write([]byte{ id, 0x11, 0x00 })
+	}
+
+	// DC and AC tables, each with a single 1 bit code for a difference of 0
+	// and the end of the block
+	b.Write([]byte{ 0xff, 0xc4, 0x00, 0x26 })
+	for _, class := range []byte{ 0x00, 0x10 } {
+		b.WriteByte(class)
+		b.WriteByte(1)
+		b.Write(make([]byte, 15))
+		b.WriteByte(0)
+	}
+
+	b.Write([]byte{ 0xff, 0xda, 0x00, 0x0e, 4 })
+	for id := byte(1); id <= 4; id++ {
+		b.Write([]byte{ id, 0x00 })
+	}
+	b.Write([]byte{ 0, 63, 0 })
+
+	// Both codes for each of the 4 blocks are 0
+	b.WriteByte(0x00)
+
+	b.Write([]byte{ 0xff, 0xd9 })
+
+	return b.Bytes()
+}
+
+func TestCmykSample(t *testing.T) {
+	img, err := jpeg.Decode(bytes.NewReader(cmykJPEG()))
+	if err != nil { t.Fatal(err) }
+
+	if _, ok := img.(*image.CMYK); !ok { t.Fatalf("sample decodes to %T, want CMYK", img) }
+}
+
+func TestJpegColor(t *testing.T) {
+	cmyk, icc, err := jpegColor(bytes.NewReader(cmykJPEG()))
+	if err != nil { t.Fatal(err) }
+	if !cmyk || icc { t.Errorf("got cmyk %v and icc %v, want a CMYK JPEG without a profile", cmyk, icc) }
+
+	var rgb bytes.Buffer
+	jpeg.Encode(&rgb, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil)
+
+	cmyk, _, err = jpegColor(&rgb)
+	if err != nil { t.Fatal(err) }
+	if cmyk { t.Error("a YCbCr JPEG was taken as CMYK") }
+}
+
+func TestCmykToSrgb(t *testing.T) {
+	script, runs := loggingScript(t, testPNG(8, 8))
+	fakePrograms(t, map[string]string{ "convert": script })
+
+	var info ConvertInfo
+	_, err := Convert(bytes.NewReader(cmykJPEG()), -1, -1, "png", WithInfo(&info))
+	if err != nil { t.Fatal(err) }
+
+	if info.Backend != "convert" { t.Errorf("converted with %q, want convert", info.Backend) }
+
+	// The last run converted, those before only asked what it can do
+	all := runs()
+	run := all[len(all)-1]
+	if !strings.Contains(run, "-colorspace sRGB") && !strings.Contains(run, "-profile ") {
+		t.Errorf("convert was run with %q, want it made sRGB", run)
+	}
+}
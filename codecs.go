@@ -0,0 +1,148 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The reference JPEG XL and JPEG 2000 encoders and decoders do a better job of
+// these formats than ImageMagick, which often isn't even built with support
+// for them. They can only convert between formats though, so anything that
+// needs resizing or editing is still left to ImageMagick
+var (
+	cjxlConverter = &converter{
+		name:       "cjxl",
+		args:       cjxlArgs,
+		supports:   codecSupports,
+		files:      true,
+		inFormats:  []string{ "png", "jpg", "gif" },
+		outFormats: []string{ "jxl" },
+	}
+
+	djxlConverter = &converter{
+		name:       "djxl",
+		args:       codecArgs,
+		supports:   codecSupports,
+		files:      true,
+		inFormats:  []string{ "jxl" },
+		outFormats: []string{ "png", "jpg" },
+	}
+
+	// OpenJPEG always compresses losslessly, so images asked for at a
+	// quality are left to ImageMagick
+	opjCompressConverter = &converter{
+		name:       "opj_compress",
+		args:       opjArgs,
+		files:      true,
+		inFormats:  []string{ "png", "bmp", "tga" },
+		outFormats: []string{ "jp2" },
+		supports: func(j *job) bool {
+			return j.opts.quality == 0 && codecSupports(j)
+		},
+	}
+
+	opjDecompressConverter = &converter{
+		name:       "opj_decompress",
+		args:       opjArgs,
+		supports:   codecSupports,
+		files:      true,
+		inFormats:  []string{ "jp2" },
+		outFormats: []string{ "png", "bmp", "tga" },
+	}
+)
+
+// codecSupports checks that j is only a change of format. CMYK input is left
+// to ImageMagick to convert to sRGB
+func codecSupports(j *job) bool {
+	return j.w <= 0 && j.h <= 0 && !j.cmyk && !j.opts.needsMagick() && !j.opts.needsBackend()
+}
+
+// codecArgs are the args of programs that just take the input and output
+// files, working out the formats from their extensions
+func codecArgs(j *job) []string {
+	return []string{ j.input, j.output }
+}
+
+func cjxlArgs(j *job) []string {
+	args := codecArgs(j)
+
+	if j.opts.quality > 0 {
+		args = append(args, "-q", strconv.Itoa(j.opts.quality))
+
+		// JPEGs are otherwise transcoded losslessly, ignoring the quality
+		if j.formatIn == "jpg" {
+			args = append(args, "--lossless_jpeg=0")
+		}
+	}
+
+	if j.opts.effort > 0 {
+		args = append(args, "-e", strconv.Itoa(j.opts.effort))
+	}
+
+	return args
+}
+
+func opjArgs(j *job) []string {
+	return []string{ "-i", j.input, "-o", j.output }
+}
+
+// executeFiles runs a program that can only read and write files. The input
+// is written to a temporary file if it isn't already in one, and the output
+// is copied to stdout once the program is done. c is updated with the args
+// it ended up being run with
+func executeFiles(c *cmd, j *job, src *source, stdout io.Writer) (string, error) {
+	dir, err := os.MkdirTemp("", "imgconv-*")
+	if err != nil { return "", err }
+	defer os.RemoveAll(dir)
+
+	// These programs go by the extensions of the files, so the spilled input
+	// is only used if it has the right one
+	fj := *j
+	fj.input = src.input()
+	if fj.input == "-" || filepath.Ext(fj.input) != "."+j.formatIn {
+		fj.input = filepath.Join(dir, "in."+j.formatIn)
+		if err := writeSource(src, fj.input); err != nil { return "", err }
+	}
+
+	fj.output = filepath.Join(dir, "out."+j.formatOut)
+	if c.conv.namesOutput {
+		base := filepath.Base(fj.input)
+		fj.output = filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base))+"."+j.formatOut)
+	}
+	c.args = c.conv.args(&fj)
+
+	stderr, err := execute(c.path, c.args, nil, j.opts, io.Discard)
+	if err != nil { return stderr, err }
+
+	out, err := os.Open(fj.output)
+	if err != nil { return stderr, err }
+	defer out.Close()
+
+	_, err = io.Copy(stdout, out)
+	return stderr, err
+}
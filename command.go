@@ -0,0 +1,122 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Words that can be given to a shell as they are
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// CommandString returns the command that converting from one format to
+// another would run, quoted so it can be pasted into a shell, for bug reports
+// and trying out a failing conversion by hand. The input and output are
+// shown as the files input.<from> and output.<to>, redirected to and from the
+// backend for those that read stdin and write stdout. As there's no actual
+// input, anything that depends on it (such as the size of an SVG) is left
+// out. Only the preferred backend is shown, as the others are only run if it
+// fails. Conversions done by the built-in converters run no command at all,
+// which is an error
+func CommandString(from string, to string, w int, h int, opts ...Option) (string, error) {
+	if err := checkRes(w, h); err != nil { return "", err }
+
+	o, err := getOptions(opts)
+	if err != nil { return "", err }
+
+	j, err := newJob(&source{}, from, w, h, to, o)
+	if err != nil { return "", err }
+
+	in, out := "input."+j.formatIn, "output."+j.formatOut
+
+	// Picking a single page is done from a file rather than stdin
+	if o.selectFrame { j.input = in }
+
+	cmds, err := getCmds(j)
+	if err != nil { return "", err }
+
+	c := cmds[0]
+	if c.conv.convert != nil {
+		return "", errors.New(j.formatIn + " to " + j.formatOut + " is converted by the built-in " +
+			c.conv.name + " converter, which doesn't run any command")
+	}
+
+	args := c.args
+	if c.conv.files {
+		fj := *j
+		fj.input, fj.output = in, out
+		args = c.conv.args(&fj)
+	}
+
+	name, args := limitCmd(c.path, args, o)
+
+	words := envChanges(o)
+	if len(words) > 0 { words = append([]string{ "env" }, words...) }
+
+	words = append(words, name)
+	words = append(words, args...)
+
+	for i := range words {
+		words[i] = shellQuote(words[i])
+	}
+
+	cmd := strings.Join(words, " ")
+	if !c.conv.files {
+		if j.input == "-" { cmd += " < " + shellQuote(in) }
+		cmd += " > " + shellQuote(out)
+	}
+
+	return cmd, nil
+}
+
+// envChanges returns the args to env that turn our environment into the one
+// backends are run with
+func envChanges(o *options) []string {
+	current := os.Environ()
+	child := childEnv(o)
+
+	var args []string
+
+	for _, v := range current {
+		key := strings.SplitN(v, "=", 2)[0]
+		if len(unsetEnv(child, key)) == len(child) {
+			args = append(args, "-u", key)
+		}
+	}
+
+	for _, v := range child {
+		if !contains(current, v) { args = append(args, v) }
+	}
+
+	return args
+}
+
+// shellQuote quotes s for POSIX shells, if it needs it
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) { return s }
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
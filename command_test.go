@@ -0,0 +1,62 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCommandString(t *testing.T) {
+	fakePrograms(t, map[string]string{ "rsvg-convert": catScript })
+
+	cmd, err := CommandString("svg", "png", 16, 16)
+	if err != nil { t.Fatal(err) }
+
+	if !strings.HasPrefix(cmd, "/fake/bin/rsvg-convert ") || !strings.HasSuffix(cmd, " < input.svg > output.png") {
+		t.Errorf("got %q, want rsvg-convert reading input.svg and writing output.png", cmd)
+	}
+}
+
+func TestCommandStringPage(t *testing.T) {
+	fakePrograms(t, map[string]string{ "convert": catScript })
+
+	// Anything written to disk would end up here
+	tmp := t.TempDir()
+	oldTmp, hadTmp := os.LookupEnv("TMPDIR")
+	os.Setenv("TMPDIR", tmp)
+	defer func() {
+		if hadTmp { os.Setenv("TMPDIR", oldTmp) } else { os.Unsetenv("TMPDIR") }
+	}()
+
+	cmd, err := CommandString("pdf", "png", -1, -1, WithPage(2))
+	if err != nil { t.Fatal(err) }
+
+	if !strings.Contains(cmd, "'input.pdf[2]'") || strings.Contains(cmd, "<") {
+		t.Errorf("got %q, want the page read from input.pdf", cmd)
+	}
+
+	if entries, _ := os.ReadDir(tmp); len(entries) > 0 {
+		t.Errorf("%s was left behind", entries[0].Name())
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"unicode/utf8"
+)
+
+// Longest comment that fits in a single JPEG COM segment
+const maxJpegComment = 65533
+
+// Escapes the characters ImageMagick treats specially in property values,
+// so a comment is stored exactly as given
+var magickEscaper = strings.NewReplacer(`\`, `\\`, "%", "%%")
+
+// magickComment escapes comment for ImageMagick's -set comment. Besides the
+// percent escapes, values starting with @ are read from the named file
+func magickComment(comment string) string {
+	comment = magickEscaper.Replace(comment)
+	if strings.HasPrefix(comment, "@") { comment = `\` + comment }
+
+	return comment
+}
+
+// addComment stores comment in b, an image encoded by Go in format. PNGs get
+// a text chunk right after the header, and JPEGs a COM segment right after
+// the start of image marker
+func addComment(b []byte, format string, comment string) ([]byte, error) {
+	switch format {
+	case "png":
+		return insertPngText(b, "Comment", comment), nil
+	case "jpg":
+		if len(comment) > maxJpegComment {
+			return nil, errors.New("comment is too long for a JPEG")
+		}
+
+		seg := []byte{ 0xff, 0xfe, 0, 0 }
+		binary.BigEndian.PutUint16(seg[2:], uint16(len(comment)+2))
+		seg = append(seg, comment...)
+
+		return splice(b, 2, seg), nil
+	}
+
+	return nil, errors.New("go: unable to store a comment in " + format)
+}
+
+// insertPngText adds a text chunk after the IHDR chunk of the PNG in b. tEXt
+// chunks are Latin-1, so anything beyond ASCII goes in an iTXt chunk as UTF-8
+// instead
+func insertPngText(b []byte, keyword string, text string) []byte {
+	typ := "tEXt"
+	data := []byte(keyword + "\x00")
+
+	if isASCII(text) {
+		data = append(data, text...)
+	} else {
+		// No compression, and empty language and translated keyword
+		typ = "iTXt"
+		data = append(data, 0, 0, 0, 0)
+		data = append(data, text...)
+	}
+
+	chunk := make([]byte, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], typ)
+	copy(chunk[8:], data)
+	binary.BigEndian.PutUint32(chunk[8+len(data):], crc32.ChecksumIEEE(chunk[4:8+len(data)]))
+
+	// The 8 byte signature and the IHDR chunk, which always holds 13 bytes
+	return splice(b, 8+12+13, chunk)
+}
+
+// splice returns b with insert inserted at i
+func splice(b []byte, i int, insert []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(b) + len(insert))
+	out.Write(b[:i])
+	out.Write(insert)
+	out.Write(b[i:])
+
+	return out.Bytes()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf { return false }
+	}
+
+	return true
+}
@@ -0,0 +1,65 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Compare decodes two images and returns how different they look, as the
+// root mean square error of their pixels normalized to the range 0 (identical)
+// to 1 (as different as can be). This is meant for checking rendered output
+// against a known good file while allowing for small compression differences,
+// eg: diff < 0.01. The images can be in different formats, but must have the
+// same dimensions. Colors are weighted by their alpha, so fully transparent
+// pixels match no matter what color they hold
+func Compare(a io.Reader, b io.Reader, opts ...Option) (float64, error) {
+	pa, aw, ah, err := ConvertRaw(a, -1, -1, opts...)
+	if err != nil { return 0, err }
+
+	pb, bw, bh, err := ConvertRaw(b, -1, -1, opts...)
+	if err != nil { return 0, err }
+
+	if aw != bw || ah != bh {
+		return 0, fmt.Errorf("can't compare images of different sizes (%dx%d and %dx%d)", aw, ah, bw, bh)
+	}
+
+	if len(pa) == 0 { return 0, nil }
+
+	var sum float64
+	for i := 0; i < len(pa); i += 4 {
+		alphaA := float64(pa[i+3]) / 255
+		alphaB := float64(pb[i+3]) / 255
+
+		for c := 0; c < 3; c++ {
+			d := float64(pa[i+c])*alphaA - float64(pb[i+c])*alphaB
+			sum += d * d
+		}
+
+		d := float64(pa[i+3]) - float64(pb[i+3])
+		sum += d * d
+	}
+
+	return math.Sqrt(sum/float64(len(pa))) / 255, nil
+}
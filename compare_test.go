@@ -0,0 +1,90 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// solidImage is a w x h image filled with c
+func solidImage(w int, h int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+
+	return img
+}
+
+func solidPNG(w int, h int, c color.Color) []byte {
+	var b bytes.Buffer
+	png.Encode(&b, solidImage(w, h, c))
+
+	return b.Bytes()
+}
+
+func TestCompareIdentical(t *testing.T) {
+	fakePrograms(t, map[string]string{})
+
+	diff, err := Compare(bytes.NewReader(testPNG(16, 16)), bytes.NewReader(testPNG(16, 16)))
+	if err != nil { t.Fatal(err) }
+	if diff != 0 { t.Errorf("identical images differ by %v", diff) }
+}
+
+func TestCompareOpposite(t *testing.T) {
+	fakePrograms(t, map[string]string{})
+
+	black := solidPNG(16, 16, color.Black)
+	white := solidPNG(16, 16, color.White)
+
+	diff, err := Compare(bytes.NewReader(black), bytes.NewReader(white))
+	if err != nil { t.Fatal(err) }
+
+	// Every color channel is as far apart as it can be, the alpha isn't
+	if want := 0.866; diff < want-0.001 || diff > want+0.001 {
+		t.Errorf("black and white differ by %v, want %v", diff, want)
+	}
+}
+
+func TestCompareFormats(t *testing.T) {
+	fakePrograms(t, map[string]string{})
+
+	gray := color.RGBA{ 128, 128, 128, 255 }
+
+	var jpg bytes.Buffer
+	jpeg.Encode(&jpg, solidImage(16, 16, gray), &jpeg.Options{ Quality: 90 })
+
+	diff, err := Compare(bytes.NewReader(solidPNG(16, 16, gray)), &jpg)
+	if err != nil { t.Fatal(err) }
+	if diff > 0.01 { t.Errorf("PNG and JPEG of the same image differ by %v", diff) }
+}
+
+func TestCompareSizes(t *testing.T) {
+	fakePrograms(t, map[string]string{})
+
+	_, err := Compare(bytes.NewReader(testPNG(16, 16)), bytes.NewReader(testPNG(16, 8)))
+	if err == nil { t.Error("images of different sizes were compared") }
+}
@@ -0,0 +1,53 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"strconv"
+)
+
+// libwebp's own encoder, which gives more control over the speed and size
+// tradeoff than ImageMagick. Like the other codecs, it's only used for
+// changing formats, leaving anything else to ImageMagick
+var cwebpConverter = &converter{
+	name:       "cwebp",
+	args:       cwebpArgs,
+	supports:   codecSupports,
+	files:      true,
+	inFormats:  []string{ "png", "jpg", "tiff" },
+	outFormats: []string{ "webp" },
+}
+
+func cwebpArgs(j *job) []string {
+	args := []string{ "-quiet" }
+
+	if j.opts.quality > 0 {
+		args = append(args, "-q", strconv.Itoa(j.opts.quality))
+	}
+
+	if j.opts.hasWebpMethod {
+		args = append(args, "-m", strconv.Itoa(j.opts.webpMethod))
+	}
+
+	return append(args, j.input, "-o", j.output)
+}
@@ -0,0 +1,58 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ConvertToDataURI converts an image and wraps it in a base64 data URI (eg:
+// data:image/png;base64,...), ready to be embedded in HTML or JSON. format
+// must have a known MIME type, which rules out things like xcf
+func ConvertToDataURI(data io.Reader, w int, h int, format string, opts ...Option) (string, error) {
+	o, err := getOptions(opts)
+	if err != nil { return "", err }
+
+	format, err = o.outputFormat(format, "")
+	if err != nil { return "", err }
+
+	mimeType, ok := formatMimes[format]
+	if !ok {
+		return "", errors.New("no known MIME type for " + format)
+	}
+
+	out, err := Convert(data, w, h, format, opts...)
+	if err != nil { return "", err }
+
+	var b strings.Builder
+	b.WriteString("data:" + mimeType + ";base64,")
+
+	enc := base64.NewEncoder(base64.StdEncoding, &b)
+	if _, err := io.Copy(enc, out); err != nil { return "", err }
+	enc.Close()
+
+	return b.String(), nil
+}
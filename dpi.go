@@ -0,0 +1,207 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// readDPI reads the resolution stored in the metadata of an image, returning
+// 0, 0 if there isn't any (or it only gives an aspect ratio)
+func readDPI(mimetype string, b []byte) (float64, float64) {
+	switch mimetype {
+	case "png":
+		return pngDPI(b)
+	case "jpg":
+		return jpegDPI(b)
+	case "tiff":
+		return tiffDPI(b)
+	}
+
+	return 0, 0
+}
+
+// pngDPI reads the pHYs chunk of a PNG
+func pngDPI(b []byte) (float64, float64) {
+	// Skip the signature
+	if len(b) < 8 { return 0, 0 }
+	b = b[8:]
+
+	for len(b) >= 12 {
+		length := int(binary.BigEndian.Uint32(b))
+		kind := string(b[4:8])
+		if length < 0 || len(b) < 12+length { break }
+
+		data := b[8 : 8+length]
+
+		// pHYs has to come before the image data
+		if kind == "IDAT" { break }
+
+		if kind == "pHYs" && length == 9 {
+			x := float64(binary.BigEndian.Uint32(data))
+			y := float64(binary.BigEndian.Uint32(data[4:]))
+
+			// Unit 1 is meters, 0 means only the aspect ratio is known
+			if data[8] == 1 {
+				return x * 0.0254, y * 0.0254
+			}
+
+			return 0, 0
+		}
+
+		b = b[12+length:]
+	}
+
+	return 0, 0
+}
+
+// jpegDPI reads the density from a JPEG's JFIF header, or failing that, its
+// EXIF data
+func jpegDPI(b []byte) (float64, float64) {
+	if len(b) < 2 || b[0] != 0xff || b[1] != 0xd8 { return 0, 0 }
+	b = b[2:]
+
+	for len(b) >= 4 && b[0] == 0xff {
+		marker := b[1]
+		length := int(binary.BigEndian.Uint16(b[2:]))
+		if length < 2 || len(b) < 2+length { break }
+
+		data := b[4 : 2+length]
+
+		switch {
+		// JFIF APP0
+		case marker == 0xe0 && len(data) >= 12 && bytes.HasPrefix(data, []byte("JFIF\x00")):
+			units := data[7]
+			x := float64(binary.BigEndian.Uint16(data[8:]))
+			y := float64(binary.BigEndian.Uint16(data[10:]))
+
+			// 1 is dots per inch, 2 dots per cm and 0 only an aspect ratio
+			switch units {
+			case 1:
+				return x, y
+			case 2:
+				return x * 2.54, y * 2.54
+			}
+
+		// EXIF APP1
+		case marker == 0xe1 && bytes.HasPrefix(data, []byte("Exif\x00\x00")):
+			if x, y := tiffDPI(data[6:]); x > 0 {
+				return x, y
+			}
+
+		// Start of scan, there's no metadata past here
+		case marker == 0xda:
+			return 0, 0
+		}
+
+		b = b[2+length:]
+	}
+
+	return 0, 0
+}
+
+// tiffDPI reads the resolution tags of the first IFD of TIFF data, which is
+// also how EXIF data is laid out
+func tiffDPI(b []byte) (float64, float64) {
+	t, ok := newTiffReader(b)
+	if !ok { return 0, 0 }
+
+	var x, y float64
+	unit := 2 // Inches are the default
+
+	t.eachTag(func(tag uint16, kind uint16, value []byte) {
+		switch tag {
+		case 0x011a:
+			x = t.rational(kind, value)
+		case 0x011b:
+			y = t.rational(kind, value)
+		case 0x0128:
+			if kind == 3 { unit = int(t.order.Uint16(value)) }
+		}
+	})
+
+	switch unit {
+	case 2:
+		return x, y
+	case 3:
+		return x * 2.54, y * 2.54
+	}
+
+	return 0, 0
+}
+
+// tiffReader reads tags out of the first IFD of TIFF formatted data
+type tiffReader struct {
+	b     []byte
+	order binary.ByteOrder
+	ifd   int
+}
+
+func newTiffReader(b []byte) (*tiffReader, bool) {
+	if len(b) < 8 { return nil, false }
+
+	t := &tiffReader{ b: b }
+
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, false
+	}
+
+	t.ifd = int(t.order.Uint32(b[4:]))
+	if t.ifd < 8 || t.ifd+2 > len(b) { return nil, false }
+
+	return t, true
+}
+
+// eachTag calls fn with every tag in the IFD. value is the 4 byte value field
+// of the entry, which holds either the value itself or an offset to it
+func (t *tiffReader) eachTag(fn func(tag uint16, kind uint16, value []byte)) {
+	count := int(t.order.Uint16(t.b[t.ifd:]))
+
+	for i := 0; i < count; i++ {
+		entry := t.ifd + 2 + i*12
+		if entry+12 > len(t.b) { return }
+
+		e := t.b[entry : entry+12]
+		fn(t.order.Uint16(e), t.order.Uint16(e[2:]), e[8:12])
+	}
+}
+
+// rational reads a RATIONAL value, which is always stored at an offset
+func (t *tiffReader) rational(kind uint16, value []byte) float64 {
+	if kind != 5 { return 0 }
+
+	offset := int(t.order.Uint32(value))
+	if offset < 0 || offset+8 > len(t.b) { return 0 }
+
+	num := float64(t.order.Uint32(t.b[offset:]))
+	den := float64(t.order.Uint32(t.b[offset+4:]))
+	if den == 0 { return 0 }
+
+	return num / den
+}
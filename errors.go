@@ -0,0 +1,64 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+)
+
+// ErrEmptyOutput is wrapped by the error of a backend that exited successfully
+// without writing anything, which some do when misconfigured
+var ErrEmptyOutput = errors.New("backend produced empty output")
+
+// ConvertError is returned when a backend fails. Its message is everything
+// the backend wrote to stderr, which is what's wanted for debugging but can
+// be long and give away paths on the system, so WithErrorSummary can be used
+// to give only a short summary instead. Either way the full detail is kept
+// here for logging
+type ConvertError struct {
+	From    string // Format being converted from, "" if unknown
+	To      string // Format being converted to, "" if unknown
+	Program string // Path of the backend that failed
+	Stderr  string // Everything the backend wrote to stderr
+	Err     error  // The full error
+
+	summary bool
+}
+
+func (e *ConvertError) Error() string {
+	if e.summary { return e.Summary() }
+
+	return e.Err.Error()
+}
+
+func (e *ConvertError) Unwrap() error {
+	return e.Err
+}
+
+// Summary describes the failure in a single line without any detail from the
+// backend, which is safe to show to users
+func (e *ConvertError) Summary() string {
+	if e.From == "" || e.To == "" { return "image conversion failed" }
+
+	return "converting " + e.From + " to " + e.To + " failed"
+}
@@ -0,0 +1,103 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+	"io"
+	"math"
+)
+
+// The most pixels EstimateSize converts to get its estimate. Anything larger
+// is estimated from a proxy of this size
+const estimatePixels = 256 * 256
+
+// EstimateSize gives a rough idea of how many bytes converting data with the
+// same arguments as Convert would give, without doing the full conversion.
+// Images that would come out larger than 256x256 are converted to a proxy of
+// that size, and its size is scaled up by the difference in pixels. This is
+// only meant to be within an order of magnitude or so, as how well an image
+// compresses depends heavily on its content and the size it's rendered at
+func EstimateSize(data io.Reader, w int, h int, format string, opts ...Option) (int, error) {
+	if err := checkRes(w, h); err != nil { return 0, err }
+
+	o, err := getOptions(opts)
+	if err != nil { return 0, err }
+
+	format, err = o.outputFormat(format, "")
+	if err != nil { return 0, err }
+
+	mimetype, src, err := readInput(data, o, videoFormats...)
+	defer src.remove()
+	if err != nil { return 0, err }
+
+	nw, nh, err := outputSize(mimetype, src, o)
+
+	// The output's own size is needed to know how much smaller the proxy is
+	tw, th := w, h
+	if w == -1 && h == -1 {
+		if err != nil {
+			return 0, errors.New("unable to estimate the size of an image with unknown dimensions")
+		}
+
+		tw, th = nw, nh
+	}
+
+	// Fitting keeps the aspect ratio, so the output is only as large as the
+	// image scaled to fit the resolution
+	fw, fh := tw, th
+	if err == nil && o.resize == ResizeFit {
+		fw, fh = fitSize(nw, nh, tw, th)
+	}
+
+	if o.squarePad {
+		if fh > fw { fw = fh }
+		fh = fw
+	}
+
+	pixels := float64(fw) * float64(fh)
+
+	// Small enough to just convert
+	if pixels <= estimatePixels {
+		out, err := convert(src, mimetype, w, h, format, o)
+		if err != nil { return 0, err }
+
+		n, err := io.Copy(io.Discard, out)
+		return int(n), err
+	}
+
+	scale := math.Sqrt(estimatePixels / pixels)
+	pw := int(math.Max(1, math.Round(float64(tw)*scale)))
+	ph := int(math.Max(1, math.Round(float64(th)*scale)))
+
+	out, err := convert(src, mimetype, pw, ph, format, o)
+	if err != nil { return 0, err }
+
+	n, err := io.Copy(io.Discard, out)
+	if err != nil { return 0, err }
+
+	// The size of vector output has little to do with its resolution
+	if contains(vectorFormats, format) { return int(n), nil }
+
+	return int(float64(n) / (scale * scale)), nil
+}
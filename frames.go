@@ -0,0 +1,155 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frame is a single frame of an animation, see Frames
+type Frame struct {
+	Index int           // Position of the frame, starting at 0
+	Image []byte        // The frame as a PNG, as it's shown at this point
+	Delay time.Duration // How long the frame is shown for
+}
+
+// Frames decodes every frame of an animated image (GIF, WebP, etc). Frames
+// that only update part of the image are drawn over the ones before them, so
+// each is the whole image as it's shown at that point. Still images give a
+// single frame. GIFs are decoded in Go, anything else requires ImageMagick
+func Frames(data io.Reader, opts ...Option) ([]Frame, error) {
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	mimetype, src, err := readInput(data, o)
+	defer src.remove()
+	if err != nil { return nil, err }
+
+	if mimetype == "gif" {
+		r, err := src.reader()
+		if err != nil { return nil, err }
+		defer closeReader(r)
+
+		return gifFrames(r)
+	}
+
+	if !contains(magickInFormats, mimetype) {
+		return nil, errors.New("ImageMagick can't read " + mimetype)
+	}
+
+	cmd, sub, err := findMagick("convert")
+	if err != nil {
+		return nil, errors.New("Frames requires ImageMagick to be installed for " + mimetype)
+	}
+
+	dir, err := os.MkdirTemp("", "imgconv-*")
+	if err != nil { return nil, err }
+	defer os.RemoveAll(dir)
+
+	pattern := filepath.Join(dir, "frame-%d.png")
+
+	args := append(magickLimits(o), src.input(), "-coalesce", "png:"+pattern)
+	if _, err := run(cmd, append(sub, args...), src, o); err != nil { return nil, err }
+
+	// Delays are given in hundredths of a second
+	args = append(magickLimits(o), src.input(), "-format", "%T\n", "info:")
+	out, err := run(cmd, append(sub, args...), src, o)
+	if err != nil { return nil, err }
+	delays := strings.Fields(string(out))
+
+	pages := findPages(pattern)
+
+	// Like with ConvertPages, a single frame may not be numbered
+	if len(pages) == 0 {
+		pages = []string{ pattern }
+	}
+
+	var frames []Frame
+	for i, page := range pages {
+		b, err := os.ReadFile(page)
+		if err != nil { return nil, err }
+
+		frame := Frame{ Index: i, Image: b }
+		if i < len(delays) {
+			n, _ := strconv.Atoi(delays[i])
+			frame.Delay = time.Duration(n) * 10 * time.Millisecond
+		}
+
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
+
+// gifFrames decodes every frame of a GIF, drawing each one over what's left
+// of the frames before it as its disposal method says
+func gifFrames(r io.Reader) ([]Frame, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil { return nil, err }
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() { bounds = g.Image[0].Bounds() }
+
+	canvas := image.NewRGBA(bounds)
+
+	var frames []Frame
+	for i, img := range g.Image {
+		disposal := byte(0)
+		if i < len(g.Disposal) { disposal = g.Disposal[i] }
+
+		var prev *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			prev = image.NewRGBA(bounds)
+			draw.Draw(prev, bounds, canvas, bounds.Min, draw.Src)
+		}
+
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+
+		b, err := encode(canvas, "png", 0)
+		if err != nil { return nil, err }
+
+		frames = append(frames, Frame{
+			Index: i,
+			Image: b,
+			Delay: time.Duration(g.Delay[i]) * 10 * time.Millisecond,
+		})
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = prev
+		}
+	}
+
+	return frames, nil
+}
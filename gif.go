@@ -0,0 +1,60 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bytes"
+	"image/gif"
+)
+
+// keepGifTiming gives each frame of a converted animated GIF the delay and
+// disposal method of the same frame of the input, along with its loop count,
+// so resizing it can't change how fast or how it plays. Backends normally
+// keep these, but nothing is lost by making sure. If the number of frames
+// changed they can't be matched up, so out is left as it is
+func keepGifTiming(src *source, out []byte) ([]byte, error) {
+	r, err := src.reader()
+	if err != nil { return nil, err }
+	defer closeReader(r)
+
+	in, err := gif.DecodeAll(r)
+	if err != nil || len(in.Image) < 2 { return out, nil }
+
+	g, err := gif.DecodeAll(bytes.NewReader(out))
+	if err != nil || len(g.Image) != len(in.Image) { return out, nil }
+
+	changed := g.LoopCount != in.LoopCount
+	for i := range g.Image {
+		if g.Delay[i] != in.Delay[i] || g.Disposal[i] != in.Disposal[i] {
+			changed = true
+		}
+	}
+
+	if !changed { return out, nil }
+
+	g.Delay, g.Disposal, g.LoopCount = in.Delay, in.Disposal, in.LoopCount
+
+	var b bytes.Buffer
+	err = gif.EncodeAll(&b, g)
+	return b.Bytes(), err
+}
@@ -0,0 +1,100 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// testGIF returns an animation of w x h frames, one for each delay given in
+// hundredths of a second
+func testGIF(w int, h int, disposal byte, delays ...int) []byte {
+	palette := color.Palette{ color.Black, color.White }
+
+	g := &gif.GIF{ LoopCount: 3 }
+	for i, delay := range delays {
+		img := image.NewPaletted(image.Rect(0, 0, w, h), palette)
+		img.SetColorIndex(i%w, 0, 1)
+
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, delay)
+		g.Disposal = append(g.Disposal, disposal)
+	}
+
+	var b bytes.Buffer
+	gif.EncodeAll(&b, g)
+
+	return b.Bytes()
+}
+
+func totalDelay(g *gif.GIF) int {
+	total := 0
+	for _, delay := range g.Delay {
+		total += delay
+	}
+
+	return total
+}
+
+func TestGifTiming(t *testing.T) {
+	in := testGIF(32, 32, gif.DisposalBackground, 10, 20, 30, 40)
+
+	// Stands in for a backend that resizes every frame but loses the timing
+	script, _ := loggingScript(t, testGIF(16, 16, gif.DisposalNone, 0, 0, 0, 0))
+	fakePrograms(t, map[string]string{ "convert": script })
+
+	r, err := Convert(bytes.NewReader(in), 16, 16, "gif")
+	if err != nil { t.Fatal(err) }
+
+	before, err := gif.DecodeAll(bytes.NewReader(in))
+	if err != nil { t.Fatal(err) }
+
+	after, err := gif.DecodeAll(r)
+	if err != nil { t.Fatal(err) }
+
+	if len(after.Image) != len(before.Image) {
+		t.Fatalf("%d frames after converting, want %d", len(after.Image), len(before.Image))
+	}
+
+	if totalDelay(after) != totalDelay(before) {
+		t.Errorf("plays for %d hundredths of a second after converting, want %d", totalDelay(after), totalDelay(before))
+	}
+
+	for i := range after.Image {
+		if after.Delay[i] != before.Delay[i] || after.Disposal[i] != before.Disposal[i] {
+			t.Errorf("frame %d has delay %d and disposal %d, want %d and %d", i,
+				after.Delay[i], after.Disposal[i], before.Delay[i], before.Disposal[i])
+		}
+	}
+
+	if after.LoopCount != before.LoopCount {
+		t.Errorf("loops %d times after converting, want %d", after.LoopCount, before.LoopCount)
+	}
+
+	if b := after.Image[0].Bounds(); b.Dx() != 16 || b.Dy() != 16 {
+		t.Errorf("frames are %dx%d, want them resized to 16x16", b.Dx(), b.Dy())
+	}
+}
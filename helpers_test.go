@@ -0,0 +1,109 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakePrograms makes the programs in scripts the only ones installed for the
+// rest of the test, each running its shell script in place of the real
+// program. The script is given the args the program was run with as $@
+func fakePrograms(t *testing.T, scripts map[string]string) {
+	t.Helper()
+
+	oldLookPath, oldExecCommand := lookPath, execCommand
+	t.Cleanup(func() {
+		lookPath, execCommand = oldLookPath, oldExecCommand
+		resetCaches()
+	})
+	resetCaches()
+
+	lookPath = func(name string) (string, error) {
+		if _, ok := scripts[name]; !ok { return "", exec.ErrNotFound }
+
+		return "/fake/bin/" + name, nil
+	}
+
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		script, ok := scripts[filepath.Base(name)]
+		if !ok { script = "echo " + name + " isn't faked >&2; exit 127" }
+
+		return exec.CommandContext(ctx, "sh", append([]string{ "-c", script, name }, args...)...)
+	}
+}
+
+// resetCaches forgets every program found and what was learned about them
+func resetCaches() {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	pathCache = make(map[string]string)
+	versionCache = make(map[string]string)
+	magickFormatCache = make(map[string]*magickFormats)
+}
+
+// testPNG returns a w x h PNG, red along its top row and transparent below
+func testPNG(w int, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.RGBA{ 255, 0, 0, 255 })
+	}
+
+	var b bytes.Buffer
+	png.Encode(&b, img)
+
+	return b.Bytes()
+}
+
+// testSVG is an SVG with a size of 16x8
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="8"><rect width="16" height="8"/></svg>`
+
+// catScript writes the input of a program run on stdin back out, standing in
+// for a conversion that worked
+const catScript = "cat"
+
+// loggingScript returns a script that writes out, after reading its input,
+// and a func returning the args of every run of it so far, one line per run
+func loggingScript(t *testing.T, out []byte) (string, func() []string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	outPath, logPath := filepath.Join(dir, "out"), filepath.Join(dir, "log")
+	if err := os.WriteFile(outPath, out, 0644); err != nil { t.Fatal(err) }
+
+	script := `echo "$@" >> '` + logPath + `'; cat >/dev/null; cat '` + outPath + `'`
+
+	return script, func() []string {
+		b, _ := os.ReadFile(logPath)
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"sort"
+)
+
+// Sizes of the images held by each type of ICNS element. Masks are left out,
+// as they aren't images of their own
+var icnsTypes = map[string]int{
+	"icp4": 16,  "icp5": 32,  "icp6": 64,  "ic07": 128,  "ic08": 256,
+	"ic09": 512, "ic10": 1024, "ic11": 32, "ic12": 64,   "ic13": 256,
+	"ic14": 512, "ic04": 16,  "ic05": 32,  "is32": 16,   "il32": 32,
+	"ih32": 48,  "it32": 128, "ICN#": 32,
+}
+
+// Sizes written to ICNS files, along with the element types each is stored
+// as. Those ending in @2x are the same image as the retina version of the
+// size below it
+var icnsSizes = []struct {
+	size  int
+	types []string
+}{
+	{ 16,   []string{ "icp4" } },
+	{ 32,   []string{ "icp5", "ic11" } },
+	{ 64,   []string{ "icp6", "ic12" } },
+	{ 128,  []string{ "ic07" } },
+	{ 256,  []string{ "ic08", "ic13" } },
+	{ 512,  []string{ "ic09", "ic14" } },
+	{ 1024, []string{ "ic10" } },
+}
+
+// Writes ICNS files holding the image at every size up to the resolution
+// asked for (or its own size), rather than the single size ImageMagick writes
+var icnsConverter = &converter{
+	name:       "icns",
+	inFormats:  magickInFormats,
+	outFormats: []string{ "icns" },
+}
+
+// writeIcns converts each size through the rest of the converters, which
+// would be an initialization loop if it were set above
+func init() {
+	icnsConverter.convert = writeIcns
+}
+
+type icnsElement struct {
+	kind string
+	data []byte
+}
+
+// icnsElements splits an ICNS file into its elements, stopping at the first
+// one that's cut off
+func icnsElements(b []byte) []icnsElement {
+	if len(b) < 8 || string(b[:4]) != "icns" { return nil }
+
+	var elements []icnsElement
+	for b = b[8:]; len(b) >= 8; {
+		n := int(binary.BigEndian.Uint32(b[4:8]))
+		if n < 8 || n > len(b) { break }
+
+		elements = append(elements, icnsElement{ kind: string(b[:4]), data: b[8:n] })
+		b = b[n:]
+	}
+
+	return elements
+}
+
+// icnsImageSizes returns the sizes of every image in an ICNS file, smallest
+// first
+func icnsImageSizes(b []byte) []int {
+	var sizes []int
+
+	for _, el := range icnsElements(b) {
+		size, ok := icnsTypes[el.kind]
+		if !ok { continue }
+
+		found := false
+		for _, s := range sizes {
+			if s == size { found = true }
+		}
+
+		if !found { sizes = append(sizes, size) }
+	}
+
+	sort.Ints(sizes)
+	return sizes
+}
+
+// largestIcns swaps an ICNS input for the largest image it holds, as only one
+// can be converted. The newer element types hold whole PNG or JPEG 2000
+// files, so those are used as they are. Files with none of them are left for
+// ImageMagick to deal with
+func largestIcns(src *source) (string, *source, error) {
+	r, err := src.reader()
+	if err != nil { return "icns", src, err }
+
+	b, err := io.ReadAll(r)
+	closeReader(r)
+	if err != nil { return "icns", src, err }
+
+	var best []byte
+	format, largest := "icns", 0
+
+	for _, el := range icnsElements(b) {
+		size := icnsTypes[el.kind]
+		if size <= largest { continue }
+
+		switch {
+		case bytes.HasPrefix(el.data, []byte("\x89PNG")):
+			format = "png"
+		case isJPEG2000("jp2 ")(el.data):
+			format = "jp2"
+		default:
+			continue
+		}
+
+		best, largest = el.data, size
+	}
+
+	if best == nil { return "icns", src, nil }
+
+	src.remove()
+	return format, &source{ data: best }, nil
+}
+
+// writeIcns converts the input to a PNG at each size and bundles them into an
+// ICNS file. SVGs are rendered at every size rather than scaled down
+func writeIcns(j *job, r io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(r)
+	if err != nil { return nil, err }
+	src := &source{ data: b }
+
+	limit := j.w
+	if j.h > limit { limit = j.h }
+
+	// Raster images aren't scaled up past their own size
+	if limit <= 0 {
+		limit = icnsSizes[len(icnsSizes)-1].size
+		if j.formatIn != "svg" {
+			if w, h, err := probeSize(j.formatIn, src, j.opts); err == nil {
+				limit = w
+				if h > limit { limit = h }
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	for i, s := range icnsSizes {
+		if s.size > limit && i > 0 { break }
+
+		out, err := convert(src, j.formatIn, s.size, s.size, "png", j.opts)
+		if err != nil { return nil, err }
+
+		img, err := squarePng(out, s.size)
+		if err != nil { return nil, err }
+
+		for _, kind := range s.types {
+			body.WriteString(kind)
+			binary.Write(&body, binary.BigEndian, uint32(8+len(img)))
+			body.Write(img)
+		}
+	}
+
+	out := make([]byte, 8, 8+body.Len())
+	copy(out, "icns")
+	binary.BigEndian.PutUint32(out[4:], uint32(8+body.Len()))
+
+	return append(out, body.Bytes()...), nil
+}
+
+// squarePng reads a PNG that was fit within size x size, centering it on a
+// transparent square of that size if it isn't one already, as every image in
+// an ICNS file has to be
+func squarePng(r io.Reader, size int) ([]byte, error) {
+	b, err := io.ReadAll(r)
+	if err != nil { return nil, err }
+
+	cfg, err := png.DecodeConfig(bytes.NewReader(b))
+	if err != nil { return nil, err }
+	if cfg.Width == size && cfg.Height == size { return b, nil }
+
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil { return nil, err }
+
+	square := image.NewNRGBA(image.Rect(0, 0, size, size))
+	at := image.Pt((size-cfg.Width)/2, (size-cfg.Height)/2)
+	draw.Draw(square, image.Rectangle{ at, at.Add(image.Pt(cfg.Width, cfg.Height)) }, img, img.Bounds().Min, draw.Src)
+
+	var out bytes.Buffer
+	err = png.Encode(&out, square)
+	return out.Bytes(), err
+}
@@ -0,0 +1,138 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// IconSpec lists the files GenerateIconSet writes
+type IconSpec []Icon
+
+// Icon is a single file of an IconSpec
+type Icon struct {
+	Name   string // File name, relative to the destination directory
+	Format string // Format of the file, taken from the extension of Name if ""
+
+	// Sizes (width and height) the icon is rendered at. Only ICO files can
+	// hold more than one, each being at most 256
+	Sizes []int
+}
+
+// WebIcons is the usual set of icons for a website: a favicon holding the
+// sizes browsers use, the icon iOS uses for home screen shortcuts and the two
+// sizes a PWA manifest needs
+var WebIcons = IconSpec{
+	{ Name: "favicon.ico",          Sizes: []int{ 16, 32, 48 } },
+	{ Name: "apple-touch-icon.png", Sizes: []int{ 180 } },
+	{ Name: "icon-192.png",         Sizes: []int{ 192 } },
+	{ Name: "icon-512.png",         Sizes: []int{ 512 } },
+}
+
+// GenerateIconSet renders every icon in spec from a single image (usually an
+// SVG) into destDir, which is created if it doesn't exist. Icons are fit to
+// their size like Convert, so non-square images should be given WithSquarePad
+// or WithResizeMode to come out square. ICO files with several sizes hold a
+// render of each, which requires ImageMagick. The paths of the icons written
+// are returned in the order of spec, for generating a manifest
+func GenerateIconSet(data io.Reader, destDir string, spec IconSpec, opts ...Option) ([]string, error) {
+	if len(spec) == 0 { return nil, errors.New("no icons given") }
+
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	// Check the whole spec up front, rather than failing halfway through
+	// writing it
+	formats := make([]string, len(spec))
+	for i, icon := range spec {
+		if icon.Name == "" || filepath.Base(icon.Name) != icon.Name {
+			return nil, errors.New("invalid icon name \"" + icon.Name + "\"")
+		}
+
+		formats[i] = strings.ToLower(icon.Format)
+		if formats[i] == "" { formats[i] = formatFromPath(icon.Name) }
+		if formats[i] == "" {
+			return nil, errors.New("no format given for " + icon.Name)
+		}
+
+		if len(icon.Sizes) == 0 {
+			return nil, errors.New("no sizes given for " + icon.Name)
+		}
+
+		if len(icon.Sizes) > 1 && formats[i] != "ico" {
+			return nil, errors.New(icon.Name + ": only ICO files can hold more than one size")
+		}
+
+		for _, size := range icon.Sizes {
+			if size < 1 || (formats[i] == "ico" && size > 256) {
+				return nil, errors.New(icon.Name + ": invalid size " + strconv.Itoa(size))
+			}
+		}
+	}
+
+	mimetype, src, err := readInput(data, o)
+	defer src.remove()
+	if err != nil { return nil, err }
+
+	if err := os.MkdirAll(destDir, 0755); err != nil { return nil, err }
+
+	var paths []string
+	for i, icon := range spec {
+		out, err := renderIcon(src, mimetype, icon, formats[i], o)
+		if err != nil { return paths, fmt.Errorf("%s: %w", icon.Name, err) }
+
+		dest := filepath.Join(destDir, icon.Name)
+		if err := writeFile(dest, out); err != nil { return paths, err }
+
+		paths = append(paths, dest)
+	}
+
+	return paths, nil
+}
+
+// renderIcon converts src to a single icon. ICOs with several sizes are
+// rendered at the largest, which ImageMagick scales down for the others
+func renderIcon(src *source, mimetype string, icon Icon, format string, o *options) (io.Reader, error) {
+	size := icon.Sizes[0]
+
+	if len(icon.Sizes) > 1 {
+		sizes := make([]string, len(icon.Sizes))
+		for i, s := range icon.Sizes {
+			sizes[i] = strconv.Itoa(s)
+			if s > size { size = s }
+		}
+
+		ico := *o
+		ico.defines = append(append([]string(nil), o.defines...),
+			"icon:auto-resize="+strings.Join(sizes, ","))
+		o = &ico
+	}
+
+	return convert(src, mimetype, size, size, format, o)
+}
@@ -32,251 +32,797 @@ package imgconv
 
 import (
 	"bytes"
+	"context"
+	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	svg  "github.com/rustyoz/svg"
 	mime "github.com/gabriel-vasile/mimetype"
 )
 
-// Programs preinstalled on the system that are capable of supporting images
-type converter struct {
-	args       []string // Required args to convert image
-	inFormats  []string // Supported input formats
-	outFormats []string // Supported output formats
-}
-
-var (
-	err        error
-	converters map[string]converter
-)
+// Returned by getSvgRes when an SVG has neither a size nor a viewBox
+var errNoSvgSize = errors.New("Failed to get size information from image")
 
 // Does the same thing as Convert, but only uses one dimension as input, it
 // keeps the aspect ratio, using the input value as the maximum width or height
 // of the final image
-func ConvertWithAspect(data io.Reader, maxRes int, format string) (io.Reader, error) {
+func ConvertWithAspect(data io.Reader, maxRes int, format string, opts ...Option) (io.Reader, error) {
 	var w, h int
 
-	// This monstrosity is to split the original datastream into 3. If there
-	// is a better way to do this I'm all ears
-	buf := &bytes.Buffer{}
-	tee := io.TeeReader(data, buf)
-	n2 := io.MultiReader(buf, data)
-	buf2 := &bytes.Buffer{}
-	tee2 := io.TeeReader(n2, buf2)
-	n := io.MultiReader(buf2, n2)
+	o, err := getOptions(opts)
+	if err != nil { return data, err }
 
-	mimetype, err := GetType(tee)
-	if mimetype == "svg" {
-		ow, oh, err := getSvgRes(tee2)
-		if err != nil { return n, err }
+	mimetype, src, err := readInput(data, o, videoFormats...)
+	defer src.remove()
+	if err != nil { return originalImage(src), err }
+
+	// If the size of a raster image can't be found, the backend still keeps
+	// its aspect ratio within a square
+	ow, oh, err := outputSize(mimetype, src, o)
+
+	if err == nil {
 		w, h = scaleWithAspect(ow, oh, maxRes)
+	} else if mimetype == "svg" {
+		return originalImage(src), err
 	} else {
 		w, h = maxRes, maxRes
 	}
 
-	out, err := Convert(n, w, h, format)
-	return out, err
+	return convert(src, mimetype, w, h, format, o)
 }
 
 // Combination of ConvertFile and ConvertWithAspect
-func ConvertFileWithAspect(src string, dest string, maxRes int, format string) error {
+func ConvertFileWithAspect(src string, dest string, maxRes int, format string, opts ...Option) error {
 	in, err := os.Open(src)
 	if err != nil { return err }
+	defer in.Close()
 
-	out, err := ConvertWithAspect(in, maxRes, format)
-	if err != nil { return err }
+	if format == "" { format = formatFromPath(dest) }
 
-	file, err := os.Create(dest)
+	out, err := ConvertWithAspect(in, maxRes, format, opts...)
 	if err != nil { return err }
 
-	_, err = io.Copy(file, out)
-	file.Close()
-	if err != nil {
-		os.Remove(dest)
-		return err
+	return writeFile(dest, out)
+}
+
+// ConvertToAspectRatio converts the image to exactly ratioW:ratioH, cutting
+// the largest centered area of that ratio out of the image and scaling it so
+// the longer side is maxRes. For example, a ratio of 4:3 with a maxRes of 640
+// always gives a 640x480 image no matter the shape of the input. The area kept
+// can be moved off center with WithGravity. Cropping requires ImageMagick
+func ConvertToAspectRatio(data io.Reader, ratioW int, ratioH int, maxRes int, format string, opts ...Option) (io.Reader, error) {
+	if ratioW < 1 || ratioH < 1 {
+		return data, errors.New("aspect ratio must be above 0")
 	}
 
-	return nil
+	if maxRes < 1 {
+		return data, errors.New("maxRes must be above 0")
+	}
+
+	o, err := getOptions(opts)
+	if err != nil { return data, err }
+	o.resize, o.resizeSet = ResizeFill, true
+
+	mimetype, src, err := readInput(data, o, videoFormats...)
+	defer src.remove()
+	if err != nil { return originalImage(src), err }
+
+	// The larger ratio side gets maxRes, rounding the other to the nearest
+	// pixel
+	w, h := maxRes, maxRes
+	if ratioW >= ratioH {
+		h = (maxRes*ratioH + ratioW/2) / ratioW
+	} else {
+		w = (maxRes*ratioW + ratioH/2) / ratioH
+	}
+
+	if w < 1 { w = 1 }
+	if h < 1 { h = 1 }
+
+	return convert(src, mimetype, w, h, format, o)
+}
+
+// ConvertToWidth converts the image to exactly width pixels wide, with the
+// height following from its aspect ratio, like ImageMagick's -resize 800x
+func ConvertToWidth(data io.Reader, width int, format string, opts ...Option) (io.Reader, error) {
+	if width < 1 {
+		return data, errors.New("width must be above 0")
+	}
+
+	return convertToSide(data, width, -1, format, opts)
+}
+
+// ConvertToHeight converts the image to exactly height pixels tall, with the
+// width following from its aspect ratio, like ImageMagick's -resize x600
+func ConvertToHeight(data io.Reader, height int, format string, opts ...Option) (io.Reader, error) {
+	if height < 1 {
+		return data, errors.New("height must be above 0")
+	}
+
+	return convertToSide(data, -1, height, format, opts)
+}
+
+// convertToSide converts the image with one side fixed and the other (-1)
+// scaled to keep the aspect ratio of the input
+func convertToSide(data io.Reader, w int, h int, format string, opts []Option) (io.Reader, error) {
+	o, err := getOptions(opts)
+	if err != nil { return data, err }
+
+	mimetype, src, err := readInput(data, o, videoFormats...)
+	defer src.remove()
+	if err != nil { return originalImage(src), err }
+
+	ow, oh, err := outputSize(mimetype, src, o)
+	if err != nil { return originalImage(src), err }
+
+	if h == -1 {
+		h = int(math.Round(float64(oh) * float64(w) / float64(ow)))
+		if h < 1 { h = 1 }
+	} else {
+		w = int(math.Round(float64(ow) * float64(h) / float64(oh)))
+		if w < 1 { w = 1 }
+	}
+
+	return convert(src, mimetype, w, h, format, o)
+}
+
+// ConvertToMegapixels converts the image to about mp megapixels (million
+// pixels), keeping its aspect ratio, whichever way it's shaped. Images smaller
+// than that are scaled up. This keeps memory use and detail uniform across
+// photos of mixed shapes, where a maximum side wouldn't
+func ConvertToMegapixels(data io.Reader, mp float64, format string, opts ...Option) (io.Reader, error) {
+	if !(mp > 0) {
+		return data, errors.New("megapixels must be above 0")
+	}
+
+	o, err := getOptions(opts)
+	if err != nil { return data, err }
+
+	mimetype, src, err := readInput(data, o, videoFormats...)
+	defer src.remove()
+	if err != nil { return originalImage(src), err }
+
+	ow, oh, err := outputSize(mimetype, src, o)
+	if err != nil { return originalImage(src), err }
+
+	w, h := scaleToPixels(ow, oh, mp*1e6)
+
+	return convert(src, mimetype, w, h, format, o)
 }
 
 // Convert takes a reader (image) as input, returning a reader of the converted
 // data in the format requested. If not successful, it will return the original
 // image and an error.
-func Convert(data io.Reader, w int, h int, format string) (io.Reader, error) {
+func Convert(data io.Reader, w int, h int, format string, opts ...Option) (io.Reader, error) {
+	return ConvertContext(context.Background(), data, w, h, format, opts...)
+}
+
+// ConvertContext does the same as Convert, but stops the conversion once ctx
+// is done, killing the backend if it's running and failing with ctx's error
+// (eg: context.Canceled) rather than falling back to another. This is for
+// conversions that are no longer wanted, such as thumbnails for a request
+// that was canceled. An input still being read when ctx is done is read from
+// no further, though a read that's blocked can't be interrupted
+func ConvertContext(ctx context.Context, data io.Reader, w int, h int, format string, opts ...Option) (io.Reader, error) {
 	// Resolution cannot be 0 or less than -1, so return
-	if w == 0 || h == 0 || w < -1 || h < -1 {
-		err := errors.New("invalid resolution; must either be -1 (native resolution) or above 0")
+	if err := checkRes(w, h); err != nil {
 		return data, err
 	}
 
-	buf := &bytes.Buffer{}
-	tee := io.TeeReader(data, buf)
-	n := io.MultiReader(buf, data)
+	o, err := getOptions(opts)
+	if err != nil { return data, err }
+
+	o.ctx = ctx
 
-	mimetype, err := GetType(tee)
-	if err != nil { return n, err }
+	mimetype, src, err := readSource(data, o, o.streamInput, videoFormats...)
+	defer src.remove()
+	if err != nil { return originalImage(src), err }
 
-	// Find a program capable of converting exporting the specified format
-	convCmd, convArgs, err := getCmd(mimetype, format, w, h)
-	if err != nil { return n, err }
+	return convert(src, mimetype, w, h, format, o)
+}
 
-	// Unset LD_LIBRARY_PATH before running command in case running inside an AppImage
-	os.Unsetenv("LD_LIBRARY_PATH")
+// convert does the actual work of Convert once the input has been buffered
+func convert(src *source, mimetype string, w int, h int, format string, o *options) (io.Reader, error) {
+	j, err := newJob(src, mimetype, w, h, format, o)
+	if err != nil { return originalImage(src), err }
+
+	if err := prepareInput(j, src); err != nil { return originalImage(src), err }
+
+	if isIdentity(j) || o.skipIfMatches && !o.forceReencode && alreadyMatches(src, mimetype, w, h, j.formatOut, o) {
+		return originalImage(src), nil
+	}
+
+	// Find programs capable of converting exporting the specified format
+	cmds, err := getCmds(j)
+	if err != nil { return originalImage(src), err }
 
 	var b bytes.Buffer
+	err = runCmds(cmds, j, src, &countWriter{ w: &b, reset: b.Reset })
+	if err != nil { return bytes.NewReader(nil), err }
+
+	return &b, nil
+}
+
+// prepareInput gets src ready for j to be run on, buffering it if it has to
+// be read more than once and writing it to disk if ImageMagick has to pick a
+// single page out of it, which it can only do with files
+func prepareInput(j *job, src *source) error {
+	if !streamable(j) {
+		if err := src.fill(j.formatIn, j.opts.spillThreshold); err != nil { return err }
+	}
+
+	if j.opts.selectFrame {
+		if err := src.spill(j.formatIn); err != nil { return err }
+	}
+
+	j.input = src.input()
+
+	return nil
+}
+
+// newJob checks that a conversion of src can be done, and describes it.
+// Nothing is written to disk, that's left to prepareInput
+func newJob(src *source, mimetype string, w int, h int, format string, o *options) (*job, error) {
+	if err := checkRes(w, h); err != nil { return nil, err }
+
+	format, err := o.outputFormat(format, "")
+	if err != nil { return nil, err }
+
+	if (o.colors > 0 || o.dither != "") && !contains(paletteFormats, format) {
+		return nil, errors.New("the number of colors and dithering can only be set for palette formats (png8, gif or xpm)")
+	}
+
+	if o.pageUnit != "" && (format == "svg" || !contains(vectorFormats, format)) {
+		return nil, errors.New("the page size can only be set for pdf, ps or eps output")
+	}
+
+	if o.blockFormat != "" && format != "dds" {
+		return nil, errors.New("block compression can only be set for dds output")
+	}
+
+	if o.layers != "" && !contains(animatedFormats, format) {
+		return nil, errors.New("layer methods can only be used with animated formats (gif or webp)")
+	}
+
+	if o.depth > 0 && !containsInt(depthFormats[format], o.depth) {
+		return nil, errors.New(format + " can't be written at " + strconv.Itoa(o.depth) + " bits per channel")
+	}
+
+	// Detected formats come from a fixed list, but are checked the same as
+	// the output all the same, as they end up in args as well
+	if !formatName.MatchString(mimetype) {
+		return nil, errors.New("invalid input format " + strconv.Quote(mimetype))
+	}
+
+	if contains(rawFormats, mimetype) && (o.inputW < 1 || o.inputH < 1) {
+		return nil, errors.New("raw " + mimetype + " input needs its size given with WithInputSize")
+	}
+
+	j := &job{
+		formatIn:  mimetype,
+		formatOut: format,
+		w:         w,
+		h:         h,
+		input:     src.input(),
+		opts:      o,
+	}
+
+	if mimetype == "jpg" {
+		j.cmyk, j.iccProfile = jpegColorOf(src)
+	}
+
+	if mimetype == "svg" {
+		if sw, sh, err := svgSize(src, o); err == nil {
+			j.svgW, j.svgH = sw, sh
+		}
+
+		// Editing the size of an SVG keeps the attribute, so it's up to
+		// whatever renders it later
+		if format != "svg" { applyAspectRatio(src, o) }
+	}
+
+	// Padding to a square needs to know the size of the image, so the native
+	// resolution is asked for explicitly
+	if o.squarePad && w == -1 && h == -1 {
+		iw, ih := j.svgW, j.svgH
+		if mimetype != "svg" { iw, ih, _ = probeSize(mimetype, src, o) }
+
+		if iw <= 0 || ih <= 0 {
+			return nil, errors.New("can't pad an image of unknown size to a square, give a resolution")
+		}
+
+		j.w, j.h = iw, ih
+	}
+
+	if err := checkLimits(j); err != nil { return nil, err }
+
+	return j, nil
+}
+
+// runCmds tries each of cmds in turn until one succeeds in writing the
+// converted image to out. If they all fail the error of the first (preferred)
+// one is the most useful. When out can't be rewound, such as when streaming,
+// there's no falling back once a backend has started writing to it, and the
+// same goes for a streamed input once a backend has started reading it
+func runCmds(cmds []cmd, j *job, src *source, out *countWriter) error {
+	o := j.opts
+
+	var firstErr error
+	for i, c := range cmds {
+		if err := o.context().Err(); err != nil { return err }
+
+		o.log("backend selected", "backend", c.conv.name, "from", j.formatIn, "to", j.formatOut)
+
+		err := runRetrying(&c, j, src, out)
+		if err != nil && contains(magickPrograms, c.conv.name) && j.formatIn == "svg" && isResourceError(err) && out.rewind() {
+			err = retryDensity(&c, j, src, out)
+		}
+
+		if err == nil && out.n == 0 { err = emptyOutputError(&c, j) }
+
+		if err == nil {
+			lossy := isLossy(j) && !c.conv.lossless
+			if lossy {
+				o.log("conversion was lossy", "from", j.formatIn, "to", j.formatOut)
+			}
+
+			if o.info != nil {
+				o.info.Backend = c.conv.name
+				o.info.Args = c.args
+				o.info.Lossy = lossy
+			}
+
+			return nil
+		}
+
+		if firstErr == nil { firstErr = err }
+
+		// Every other backend would trim the image down to nothing as well
+		if err == ErrNothingToTrim { break }
+
+		if !out.rewind() || src.read { return err }
+
+		if i < len(cmds)-1 {
+			o.log("falling back to next backend", "backend", c.conv.name, "error", err)
+		}
+	}
+
+	return firstErr
+}
+
+// runRetrying is runCmd, running c again when it fails as many times as
+// WithRetries allows, waiting twice as long before each retry. Failures that
+// would only happen again, or after which the input or output can't be
+// taken back, aren't retried
+func runRetrying(c *cmd, j *job, src *source, out *countWriter) error {
+	o := j.opts
+	backoff := o.retryBackoff
+
+	err := runCmd(c, j, src, out)
+
+	for i := 0; i < o.retries && err != nil && isTransient(c, err) && !src.read && out.rewind(); i++ {
+		o.log("retrying backend", "backend", c.conv.name, "error", err, "wait", backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-o.context().Done():
+			return o.context().Err()
+		}
+		backoff *= 2
+
+		err = runCmd(c, j, src, out)
+	}
+
+	return err
+}
+
+// isTransient checks whether c failing with err might go differently if run
+// again. Converters implemented in Go and refusals by ImageMagick's policy
+// always fail the same way
+func isTransient(c *cmd, err error) bool {
+	return c.conv.convert == nil && err != ErrNothingToTrim && !errors.Is(err, ErrNotAuthorized)
+}
+
+// emptyOutputError is the error of c exiting successfully without writing
+// anything, so that the next backend is tried rather than handing back an
+// empty image
+func emptyOutputError(c *cmd, j *job) error {
+	program := c.path
+	if program == "" { program = c.conv.name }
+
+	return &ConvertError{
+		From:    j.formatIn,
+		To:      j.formatOut,
+		Program: program,
+		Err:     fmt.Errorf("%s: %w", c.conv.name, ErrEmptyOutput),
+		summary: j.opts.errorSummary,
+	}
+}
+
+// retryDensity runs ImageMagick again at lower densities after it ran out of
+// resources rendering an SVG, as a less crisp render beats none at all. c is
+// updated with the args that ended up working
+func retryDensity(c *cmd, j *job, src *source, out *countWriter) error {
+	density := svgDensity(j)
+	if density <= 0 { density = svgDPI }
+
+	var err error
+
+	for i := 0; i < 2; i++ {
+		density /= 2
+
+		j.density = density
+		c.args = c.conv.args(j)
+		j.opts.log("retrying at a lower density", "backend", c.conv.name, "density", density)
+
+		err = runCmd(c, j, src, out)
+		if err == nil {
+			if j.opts.info != nil { j.opts.info.FallbackDensity = density }
+			return nil
+		}
+
+		if !isResourceError(err) || !out.rewind() { break }
+	}
+
+	j.density = 0
+	return err
+}
+
+// isResourceError checks whether a backend failed because it ran out of
+// memory or hit one of ImageMagick's resource limits
+func isResourceError(err error) bool {
+	var ce *ConvertError
+	if errors.As(err, &ce) { err = ce.Err }
+
+	msg := strings.ToLower(err.Error())
+
+	for _, s := range []string{
+		"memory allocation failed", "resources exhausted", "out of memory",
+		"exceeds limit", "resource limit",
+	} {
+		if strings.Contains(msg, s) { return true }
+	}
+
+	return false
+}
 
-	cmd := exec.Command(convCmd, convArgs...)
-	stdin, _  := cmd.StdinPipe()
+// runCmd does the conversion with c, whether it's a program or implemented in
+// Go, writing the output to w
+func runCmd(c *cmd, j *job, src *source, w io.Writer) error {
+	if j.formatIn != "gif" || j.formatOut != "gif" || j.opts.layers != "" {
+		return runBackend(c, j, src, w)
+	}
+
+	// The timing of animations is put back from the input afterwards, which
+	// needs the whole output. Layer methods are left alone, as they change
+	// the disposal of frames on purpose
+	var b bytes.Buffer
+	if err := runBackend(c, j, src, &b); err != nil { return err }
+
+	out, err := keepGifTiming(src, b.Bytes())
+	if err != nil { return err }
+
+	_, err = w.Write(out)
+	return err
+}
+
+// runBackend is runCmd for any conversion
+func runBackend(c *cmd, j *job, src *source, w io.Writer) error {
+	if c.conv.convert == nil {
+		var stderr string
+		var err error
+
+		if c.conv.files {
+			stderr, err = executeFiles(c, j, src, w)
+		} else {
+			stderr, err = execute(c.path, c.args, src, j.opts, w)
+		}
+
+		// ImageMagick only warns when there's nothing left after trimming,
+		// and goes on to write a single transparent pixel
+		if j.opts.trim && strings.Contains(stderr, "geometry does not contain image") {
+			return ErrNothingToTrim
+		}
+
+		var ce *ConvertError
+		if errors.As(err, &ce) {
+			ce.From, ce.To = j.formatIn, j.formatOut
+
+			// Any other backend able to do the conversion is fallen back on
+			// as usual, this just makes the error clearer if there isn't one
+			if isPolicyError(stderr) {
+				ce.Err = policyError(j, c.conv.name, stderr)
+			}
+		}
+
+		return err
+	}
+
+	r, err := src.reader()
+	if err != nil { return err }
+	defer closeReader(r)
+
+	out, err := c.conv.convert(j, r)
+	if err != nil { return err }
+
+	_, err = w.Write(out)
+	return err
+}
+
+// run executes a backend, feeding it the input through stdin unless it reads
+// it from the spilled file, and returns whatever it writes to stdout. src can
+// be nil for commands that take all of their input as files
+func run(convCmd string, convArgs []string, src *source, o *options) ([]byte, error) {
+	var b bytes.Buffer
+
+	_, err := execute(convCmd, convArgs, src, o, &b)
+	return b.Bytes(), err
+}
+
+// execute is the same as run, but writes the output to stdout as the backend
+// produces it. What the backend wrote to stderr is also returned, as some only
+// warn about problems without failing
+func execute(convCmd string, convArgs []string, src *source, o *options, stdout io.Writer) (string, error) {
+	var b bytes.Buffer
+
+	name, args := limitCmd(convCmd, convArgs, o)
+
+	// The backend is killed once ctx is done
+	ctx := o.context()
+	cmd := execCommand(ctx, name, args...)
+	cmd.Env = childEnv(o)
+	cmd.Stdout = stdout
 	cmd.Stderr = &b
 
-	go func() {
-		defer stdin.Close()
-		io.Copy(stdin, n)
-	}()
+	// Copy the input into the backend in the background. Errors reading the
+	// input are kept track of so they can be reported instead of whatever the
+	// backend complains about after being fed truncated data. If the input was
+	// spilled to disk, the backend reads it from there instead
+	copyErr := make(chan error, 1)
+	if src != nil && src.input() == "-" {
+		stdin, _ := cmd.StdinPipe()
+		n, err := src.reader()
+
+		go func() {
+			defer stdin.Close()
+			if err != nil {
+				copyErr <- err
+				return
+			}
+
+			r := &errReader{r: &ctxReader{ctx: ctx, r: n}}
+			io.Copy(stdin, r)
+			copyErr <- r.err
+		}()
+	} else {
+		copyErr <- nil
+	}
+
+	o.log("process started", "cmd", convCmd, "args", convArgs)
+	start := time.Now()
+	err := cmd.Run()
+	o.log("process finished", "cmd", convCmd, "duration", time.Since(start), "error", err)
 
-	// Run the command and buffer the output
-	byteSlice, err := cmd.Output()
-	stdout := bytes.NewReader(byteSlice)
+	// Wait closes stdin once the command exits, so the copy can no longer be
+	// stuck writing to it
+	rerr := <-copyErr
+
+	// Whatever the backend died of, it was because it was killed
+	if ctx.Err() != nil { return b.String(), ctx.Err() }
+
+	if rerr != nil { return b.String(), rerr }
 
 	// If the command exits non-zero status, return stderr as the error message
 	if err != nil {
-		err = errors.New(convCmd + ": " + b.String())
-	}
-
-	return stdout, err
-}
-
-// getCmd attempts to find a suitable command to convert to the requested
-// format from the start format
-func getCmd(formatIn string, formatOut string, w int, h int) (string, []string, error) {
-	var args []string
-
-	// Supported conversion programs
-	converters = map[string]converter{
-		"rsvg-convert": {
-			args: []string{
-				"-f", formatOut,
-			},
-			inFormats:  []string{
-				"svg",
-			},
-			outFormats: []string{
-				"png", "pdf", "ps", "eps", "svg", "xml",
-			},
-		},
-
-		"convert": {
-			args: []string{
-				"-resize", strconv.Itoa(w)+"x"+strconv.Itoa(h),
-				"-background", "none",
-				"-",
-				formatOut+":-",
-			},
-			inFormats: []string{
-				"svg", "png", "xpm", "jxl", "jp2", "jpf",
-				"jpg", "gif", "webp","bmp", "ico", "bpg",
-				"dwg", "icns","heic","heif","hdr", "xcf",
-				"pat", "gbr",
-			},
-			outFormats: []string{
-				"png", "xpm", "jxl", "jp2", "jpf", "gbr",
-				"jpg", "gif", "webp","bmp", "ico", "bpg",
-				"dwg", "icns","heic","heif","hdr", "xcf",
-				"pat",
-			},
-		},
-
-		"inkscape": {
-			args: []string {
-				"-p",
-				"--export-type="+formatOut,
-				"--export-filename", "-",
-			},
-			inFormats: []string{ "svg" },
-			outFormats: []string{
-				"png", "pdf", "ps",  "eps", "svg",
-			},
-		},
-	}
-
-	// Inkscape doesn't have support for using -1 as regular resolution, so add
-	// in width and height if the resolution asked for is 0 or greater
-	if conv, present := converters["inkscape"]; present &&
-	formatIn == "svg" && w > 0 && h > 0 {
-		conv.args = append(conv.args, []string{
-			"-w", strconv.Itoa(w),
-			"-h", strconv.Itoa(h),
-		}...)
-
-		converters["inkscape"] = conv
-	}
-
-	if conv, present := converters["rsvg-convert"]; present &&
-	formatIn == "svg" && w > 0 && h > 0 {
-		conv.args = append(conv.args, []string{
-			"-w", strconv.Itoa(w),
-			"-h", strconv.Itoa(h),
-		}...)
-
-		converters["rsvg-convert"] = conv
-	}
-
-	// The DPI for convert is set to 3072 because it's the ideal DPI for
-	// converting a 16x16 SVG image to 512x512, which feels like a reasonable
-	// medium, especially because ImageMagick is less than ideal for converting
-	// SVGs anyway. If w and h set to -1, the density will not be changed
-	if conv, present := converters["convert"]; present &&
-	formatIn == "svg" && w > 0 && h > 0 {
-		conv.args = append([]string{
-			"-density", "3072",
-		}, conv.args...)
-
-		converters["convert"] = conv
-	}
-
-	// Iterate through converters making sure they're in the PATH and support the
-	// requested image format
-	for i, val := range converters {
-		if cmd, err := exec.LookPath(i); err == nil &&
-		contains(val.inFormats, formatIn) && contains(val.outFormats, formatOut) {
-			args = converters[i].args
-			return cmd, args, nil
-		} else {
-			continue
+		o.log("process failed", "cmd", convCmd, "stderr", b.String())
+		err = &ConvertError{
+			Program: convCmd,
+			Stderr:  b.String(),
+			Err:     errors.New(convCmd + ": " + b.String()),
+			summary: o.errorSummary,
 		}
 	}
 
-	err := errors.New("failed to find a suitable image conversion program on "+
-		"this machine to convert "+formatIn+" to "+formatOut)
-	return "", []string{}, err
+	return b.String(), err
+}
+
+// childEnv returns the environment backends are run with. LD_LIBRARY_PATH
+// is removed in case we're running inside an AppImage, where it would point
+// the system's programs at the wrong libraries. Only the child is affected,
+// the environment of our own process is left alone
+func childEnv(o *options) []string {
+	env := os.Environ()
+
+	if !o.keepLibraryPath {
+		env = unsetEnv(env, "LD_LIBRARY_PATH")
+	}
+
+	if o.threads > 0 {
+		n := strconv.Itoa(o.threads)
+		env = setEnv(env, "MAGICK_THREAD_LIMIT", n)
+		env = setEnv(env, "OMP_NUM_THREADS", n)
+	}
+
+	if o.memoryLimit > 0 {
+		n := strconv.FormatInt(o.memoryLimit, 10)
+		env = setEnv(env, "MAGICK_MEMORY_LIMIT", n)
+		env = setEnv(env, "MAGICK_MAP_LIMIT", n)
+	}
+
+	if o.cpuLimit > 0 {
+		env = setEnv(env, "MAGICK_TIME_LIMIT", strconv.Itoa(cpuSeconds(o.cpuLimit)))
+	}
+
+	for _, v := range o.env {
+		kv := strings.SplitN(v, "=", 2)
+		env = setEnv(env, kv[0], kv[1])
+	}
+
+	return env
+}
+
+// unsetEnv returns env without key
+func unsetEnv(env []string, key string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, v := range env {
+		if strings.HasPrefix(v, key+"=") { continue }
+		filtered = append(filtered, v)
+	}
+
+	return filtered
+}
+
+// setEnv returns env with key set to value, replacing any existing value
+func setEnv(env []string, key string, value string) []string {
+	return append(unsetEnv(env, key), key+"="+value)
+}
+
+// errReader wraps a reader, remembering the first error other than EOF that
+// it returns
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF && e.err == nil {
+		e.err = err
+	}
+
+	return n, err
+}
+
+// ctxReader wraps a reader, failing with ctx's error once it's done instead
+// of reading any further
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil { return 0, err }
+
+	return c.r.Read(p)
+}
+
+// alreadyMatches checks whether the input is already in format and fits
+// within w and h, so converting it wouldn't accomplish anything
+func alreadyMatches(src *source, mimetype string, w int, h int, format string, o *options) bool {
+	if mimetype != format { return false }
+	if w == -1 && h == -1 { return true }
+
+	iw, ih, err := probeSize(mimetype, src, o)
+	if err != nil { return false }
+
+	return (w == -1 || iw <= w) && (h == -1 || ih <= h)
+}
+
+// isIdentity checks whether j is an SVG asked for as an SVG at its own size,
+// with nothing else to do to it, in which case the input is the output
+func isIdentity(j *job) bool {
+	return j.formatIn == "svg" && j.formatOut == "svg" && j.w <= 0 && j.h <= 0 && svgConverter.supports(j)
+}
+
+// checkRes makes sure w and h are a valid resolution to convert to
+func checkRes(w int, h int) error {
+	if w == 0 || h == 0 || w < -1 || h < -1 {
+		return errors.New("invalid resolution; must either be -1 (native resolution) or above 0")
+	}
+
+	return nil
+}
+
+// originalImage returns a reader of the input so it can be handed back to the
+// caller when a conversion fails. A spilled input is read back into memory,
+// as nothing would close the file, the same as the output of a conversion is
+// held in memory
+func originalImage(src *source) io.Reader {
+	if src.path != "" {
+		b, err := os.ReadFile(src.path)
+		if err != nil { return bytes.NewReader(nil) }
+
+		return bytes.NewReader(b)
+	}
+
+	r, err := src.reader()
+	if err != nil { return bytes.NewReader(nil) }
+
+	return r
+}
+
+// closeReader closes r if it happens to be a closer, such as the file behind
+// a spilled source
+func closeReader(r io.Reader) {
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
 }
 
 // ConvertFile does the same thing as Convert, just directly to a file
-func ConvertFile(src string, dest string, w int, h int, format string) error {
+func ConvertFile(src string, dest string, w int, h int, format string, opts ...Option) error {
 	in, err := os.Open(src)
 	if err != nil { return err }
+	defer in.Close()
 
-	out, err := Convert(in, w, h, format)
+	if format == "" { format = formatFromPath(dest) }
+
+	out, err := Convert(in, w, h, format, opts...)
 	if err != nil { return err }
 
-	file, err := os.Create(dest)
+	return writeFile(dest, out)
+}
+
+// writeFile writes everything in r to a file at path. It's written to a
+// temporary file next to it first, which is renamed into place once it's
+// complete, so nothing watching path ever sees a partial file, even if the
+// process is killed partway through
+func writeFile(path string, r io.Reader) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
 	if err != nil { return err }
 
-	_, err = io.Copy(file, out)
-	file.Close()
+	// Temporary files are only readable by their owner, unlike what
+	// os.Create would have made
+	err = file.Chmod(0644)
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
+
+	if cerr := file.Close(); err == nil { err = cerr }
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+
 	if err != nil {
-		os.Remove(dest)
+		os.Remove(file.Name())
 		return err
 	}
 
 	return nil
 }
 
+// scaleToPixels scales width and height to about pixels pixels in total,
+// keeping the aspect ratio. Neither side is brought below 1
+func scaleToPixels(width int, height int, pixels float64) (int, int) {
+	scale := math.Sqrt(pixels / (float64(width) * float64(height)))
+
+	w := int(math.Round(float64(width) * scale))
+	h := int(math.Round(float64(height) * scale))
+
+	if w < 1 { w = 1 }
+	if h < 1 { h = 1 }
+
+	return w, h
+}
+
 // Takes image dimensions as input, returning those dimensions scaled while
 // keeping the aspect ratio. Example: (10, 5, 512) returns (512, 256)
 func scaleWithAspect(width int, height int, maxRes int) (int, int) {
@@ -301,33 +847,98 @@ func scaleWithAspect(width int, height int, maxRes int) (int, int) {
 
 // GetType returns the common file extension of the image presented
 func GetType(data io.Reader) (string, error) {
-	m, err := mime.DetectReader(data)
+	return getType(data)
+}
+
+// getType does the same as GetType, but also accepts the non-image formats in
+// allowed (eg: pdf for functions that can rasterize documents)
+func getType(data io.Reader, allowed ...string) (string, error) {
+	head, err := io.ReadAll(io.LimitReader(data, sniffLen))
 	if err != nil { return "", err }
+
+	m := mime.Detect(head)
 	s := strings.Split(m.String(), "/")
+	ext := strings.Replace(m.Extension(), ".", "", 1)
+
+	// Fall back on our own checks for formats the mimetype library doesn't
+	// know about. Uncompressed TGAs start with the same bytes as cursors, so
+	// those get mistaken for ICOs as well
+	if m.Is("application/octet-stream") || (ext == "ico" && !isICO(head)) {
+		if format := detectExtra(head); format != "" {
+			return format, nil
+		}
+	}
 
-	if s[0] != "image" {
+	// SVGs with a long preamble before the root element (comments, DOCTYPE,
+	// etc) are only recognized as generic XML
+	if (m.Is("text/xml") || m.Is("application/xml")) && isSVG(head) {
+		return "svg", nil
+	}
+
+	if s[0] != "image" && !contains(allowed, ext) {
 		err := errors.New("file magic wasn't detected as an image format")
 		return "", err
 	} else {
-		return strings.Replace(m.Extension(), ".", "", 1), nil
+		return ext, nil
 	}
 }
 
 // getSvgRes takes a datastream as input, returning the size of said image.
 // Like the rest of this library, it also only supports SVGs
 func getSvgRes(data io.Reader) (int, int, error) {
+	// Only the root element is needed, so it's looked for without parsing the
+	// rest of the document. The full parser is only fallen back on if that
+	// fails, with what was already read put back in front of the rest
+	var read bytes.Buffer
+	width, height, viewBox, err := svgRootAttrs(io.TeeReader(data, &read))
+	if err == nil { return svgDims(width, height, viewBox) }
+
 	// Load the SVG
-	svg, err := svg.ParseSvgFromReader(data, "", 1)
+	svg, err := svg.ParseSvgFromReader(io.MultiReader(&read, data), "", 1)
 	if err != nil { return -1, -1, err }
 
-	w, _ := strconv.Atoi(svg.Width)
-	h, _ := strconv.Atoi(svg.Height)
+	return svgDims(svg.Width, svg.Height, svg.ViewBox)
+}
 
-	// Set width and height based on viewbox if invalid
-	if w < 1 || h < 1 {
-		v := svg.ViewBox
-		res := strings.Split(v, " ")
+// svgRootAttrs reads the width, height and viewBox of the root element of an
+// SVG, stopping as soon as it's found
+func svgRootAttrs(r io.Reader) (string, string, string, error) {
+	d := xml.NewDecoder(r)
+
+	for {
+		tok, err := d.RawToken()
+		if err != nil { return "", "", "", err }
+
+		el, ok := tok.(xml.StartElement)
+		if !ok { continue }
+
+		if el.Name.Local != "svg" {
+			return "", "", "", errors.New("svg: root element isn't <svg>")
+		}
 
+		var width, height, viewBox string
+		for _, attr := range el.Attr {
+			if attr.Name.Space != "" { continue }
+
+			switch attr.Name.Local {
+			case "width":   width = attr.Value
+			case "height":  height = attr.Value
+			case "viewBox": viewBox = attr.Value
+			}
+		}
+
+		return width, height, viewBox, nil
+	}
+}
+
+// svgDims works out the size of an SVG from the attributes of its root element
+func svgDims(width string, height string, viewBox string) (int, int, error) {
+	w, _ := strconv.Atoi(width)
+	h, _ := strconv.Atoi(height)
+
+	// Set width and height based on viewbox if invalid
+	res := strings.Fields(strings.ReplaceAll(viewBox, ",", " "))
+	if (w < 1 || h < 1) && len(res) == 4 {
 		// Format of ViewBox is: x1, y1, x2, y2
 		x1, _ := strconv.ParseFloat(res[0], 32)
 		x2, _ := strconv.ParseFloat(res[2], 32)
@@ -344,8 +955,37 @@ func getSvgRes(data io.Reader) (int, int, error) {
 		return w, h, nil
 	}
 
-	err = errors.New("Failed to get size information from image")
-	return -1, -1, err
+	return -1, -1, errNoSvgSize
+}
+
+// svgSize returns the size of an SVG input. SVGs that don't specify one are
+// given the default size, rather than failing
+func svgSize(src *source, o *options) (int, int, error) {
+	w, h, err := probeSize("svg", src, o)
+	if err != errNoSvgSize { return w, h, err }
+
+	w, h = o.defaultSvgSize()
+	o.log("svg has no size or viewBox, using the default size", "width", w, "height", h)
+
+	return w, h, nil
+}
+
+// outputSize returns the size of the input as it will be before resizing,
+// which is its own size turned on its side if it's rotated by 90 or 270
+// degrees
+func outputSize(mimetype string, src *source, o *options) (int, int, error) {
+	var w, h int
+	var err error
+
+	if mimetype == "svg" {
+		w, h, err = svgSize(src, o)
+	} else {
+		w, h, err = probeSize(mimetype, src, o)
+	}
+
+	if o.rotate == 90 || o.rotate == 270 { w, h = h, w }
+
+	return w, h, err
 }
 
 func contains(slice []string, str string) bool {
@@ -355,3 +995,12 @@ func contains(slice []string, str string) bool {
 
 	return false
 }
+
+// containsInt is contains for ints
+func containsInt(slice []int, n int) bool {
+	for _, i := range slice {
+		if i == n { return true }
+	}
+
+	return false
+}
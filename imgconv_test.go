@@ -0,0 +1,125 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errBrokenReader = errors.New("read broke partway through")
+
+// brokenReader gives data, then fails instead of ending
+type brokenReader struct {
+	data io.Reader
+}
+
+// newBrokenReader is a brokenReader giving a PNG padded well past what's read
+// to detect its format, so the read fails while it's being converted
+func newBrokenReader() *brokenReader {
+	return &brokenReader{
+		data: io.MultiReader(bytes.NewReader(testPNG(8, 8)), bytes.NewReader(make([]byte, 1<<16))),
+	}
+}
+
+func (r *brokenReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF { err = errBrokenReader }
+
+	return n, err
+}
+
+func TestReadErrorStream(t *testing.T) {
+	fakePrograms(t, map[string]string{ "convert": "cat >/dev/null; echo converted" })
+
+	err := ConvertStream(newBrokenReader(), ioutil.Discard, -1, -1, "webp", WithStreamingInput())
+	if !errors.Is(err, errBrokenReader) { t.Fatalf("got %v, want the read error", err) }
+}
+
+func TestReadErrorBuffered(t *testing.T) {
+	fakePrograms(t, map[string]string{ "convert": "cat >/dev/null; echo converted" })
+
+	_, err := Convert(newBrokenReader(), -1, -1, "webp")
+	if !errors.Is(err, errBrokenReader) { t.Fatalf("got %v, want the read error", err) }
+}
+
+func TestConvertContextCancel(t *testing.T) {
+	if _, err := os.Stat("/proc/self"); err != nil { t.Skip("needs /proc to see whether the backend is still around") }
+
+	// Stands in for a backend that takes far too long, telling us its PID
+	pidPath := filepath.Join(t.TempDir(), "pid")
+	fakePrograms(t, map[string]string{ "rsvg-convert": "echo $$ > '" + pidPath + "'; exec sleep 60" })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pid := make(chan string, 1)
+	go func() {
+		for {
+			if b, err := os.ReadFile(pidPath); err == nil && bytes.HasSuffix(b, []byte("\n")) {
+				pid <- strings.TrimSpace(string(b))
+				cancel()
+				return
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	_, err := ConvertContext(ctx, strings.NewReader(testSVG), -1, -1, "png")
+	if err != ctx.Err() || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("took %v to return after being canceled", d)
+	}
+
+	// Once reaped, the process is gone entirely rather than left a zombie
+	if _, err := os.Stat("/proc/" + <-pid); err == nil {
+		t.Error("backend is still around after ConvertContext returned")
+	}
+}
+
+func TestOriginalImageSpilled(t *testing.T) {
+	fakePrograms(t, map[string]string{})
+
+	// Converting to SVG at the native size hands back the input, and to WebP
+	// fails with nothing installed, which hands it back as well
+	for _, format := range []string{ "svg", "webp" } {
+		r, _ := Convert(strings.NewReader(testSVG), -1, -1, format, WithSpillThreshold(16))
+
+		if _, ok := r.(io.Closer); ok { t.Errorf("%s: got a %T, which nothing would close", format, r) }
+
+		out, _ := ioutil.ReadAll(r)
+		if string(out) != testSVG { t.Errorf("%s: got %q, want the input", format, out) }
+	}
+}
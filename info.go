@@ -0,0 +1,198 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImageInfo describes an image without converting it
+type ImageInfo struct {
+	Format string // Common file extension of the format, as returned by GetType
+	Width  int    // Width in pixels, -1 if it couldn't be found
+	Height int    // Height in pixels, -1 if it couldn't be found
+
+	// Resolution stored in the image's metadata (PNG pHYs, JFIF, EXIF or
+	// TIFF tags) in dots per inch. 0 if the image doesn't specify one, rather
+	// than guessing at a default
+	XDPI float64
+	YDPI float64
+
+	// Sizes of every image held by ICNS and ICO files, smallest first. nil
+	// for other formats
+	Sizes []int
+}
+
+// GetInfo detects the format of an image along with its dimensions. Only the
+// format is required to be detected, so if the dimensions can't be read the
+// info is still returned with them set to -1
+func GetInfo(data io.Reader) (ImageInfo, error) {
+	info := ImageInfo{ Width: -1, Height: -1 }
+	o := &options{ wholeIcns: true }
+
+	mimetype, src, err := readInput(data, o)
+	defer src.remove()
+	if err != nil { return info, err }
+
+	info.Format = mimetype
+	info.Width, info.Height, _ = probeSize(mimetype, src, o)
+
+	if mimetype == "icns" || mimetype == "ico" {
+		r, err := src.reader()
+		if err != nil { return info, err }
+
+		b, err := io.ReadAll(r)
+		closeReader(r)
+		if err != nil { return info, err }
+
+		if mimetype == "icns" {
+			info.Sizes = icnsImageSizes(b)
+		} else {
+			info.Sizes = icoImageSizes(b)
+		}
+
+		// The largest image is the one that gets converted
+		if n := len(info.Sizes); n > 0 {
+			info.Width, info.Height = info.Sizes[n-1], info.Sizes[n-1]
+		}
+	}
+
+	// The metadata holding the resolution is always near the start
+	r, err := src.reader()
+	if err != nil { return info, err }
+	defer closeReader(r)
+
+	head, err := io.ReadAll(io.LimitReader(r, 1<<20))
+	if err != nil { return info, err }
+
+	info.XDPI, info.YDPI = readDPI(mimetype, head)
+
+	return info, nil
+}
+
+// AspectRatio returns the width of an image divided by its height, such as
+// for reserving space in a page before it's loaded. Sizes are found the same
+// way they are when converting, though an SVG without a size or viewBox has
+// no aspect ratio to speak of, so it fails instead of getting the default size
+func AspectRatio(data io.Reader) (float64, error) {
+	o := &options{}
+
+	mimetype, src, err := readInput(data, o)
+	defer src.remove()
+	if err != nil { return 0, err }
+
+	w, h, err := probeSize(mimetype, src, o)
+	if err != nil { return 0, err }
+
+	return float64(w) / float64(h), nil
+}
+
+// probeSize returns the dimensions of the input without converting it. Go
+// reads them itself for the formats it can, and anything else (or anything it
+// fails on) is left to ImageMagick's identify, if it's installed
+func probeSize(mimetype string, src *source, o *options) (int, int, error) {
+	r, err := src.reader()
+	if err != nil { return -1, -1, err }
+
+	switch mimetype {
+	case "png", "jpg", "gif":
+		var cfg image.Config
+		cfg, _, err = image.DecodeConfig(r)
+		if err == nil {
+			closeReader(r)
+			return cfg.Width, cfg.Height, nil
+		}
+	case "svg":
+		w, h, err := getSvgRes(r)
+		closeReader(r)
+
+		// ImageMagick's idea of an SVG's size isn't any better than ours
+		return w, h, err
+	default:
+		err = errors.New("unable to get the dimensions of " + mimetype + " images")
+	}
+	closeReader(r)
+
+	if !contains(magickInFormats, mimetype) { return -1, -1, err }
+
+	w, h, identifyErr := identifySize(mimetype, src, o)
+	if identifyErr != nil { return -1, -1, err }
+
+	return w, h, nil
+}
+
+// identifySize gets the dimensions of the input using ImageMagick's identify.
+// Only the first frame or layer is looked at
+func identifySize(mimetype string, src *source, o *options) (int, int, error) {
+	cmd, args, err := findMagick("identify")
+	if err != nil { return -1, -1, err }
+
+	// Formats without any magic (such as TGA) can't be read from stdin unless
+	// ImageMagick is told what they are
+	input := src.input()
+	if input == "-" { input = mimetype + ":-" }
+
+	args = append(args, "-format", "%w %h\n", input)
+
+	out, err := run(cmd, args, src, o)
+	if err != nil { return -1, -1, err }
+
+	// Every frame gets its own line
+	fields := strings.Fields(strings.SplitN(string(out), "\n", 2)[0])
+	if len(fields) != 2 {
+		return -1, -1, errors.New("identify: unexpected output " + strconv.Quote(string(out)))
+	}
+
+	w, werr := strconv.Atoi(fields[0])
+	h, herr := strconv.Atoi(fields[1])
+	if werr != nil || herr != nil || w < 1 || h < 1 {
+		return -1, -1, errors.New("identify: unexpected output " + strconv.Quote(string(out)))
+	}
+
+	return w, h, nil
+}
+
+// icoImageSizes returns the sizes of every image in an ICO file, smallest
+// first. Each image is square, and a width of 0 means 256
+func icoImageSizes(b []byte) []int {
+	if len(b) < 6 { return nil }
+
+	var sizes []int
+
+	n := int(binary.LittleEndian.Uint16(b[4:6]))
+	for i := 0; i < n && 6+16*(i+1) <= len(b); i++ {
+		size := int(b[6+16*i])
+		if size == 0 { size = 256 }
+
+		sizes = append(sizes, size)
+	}
+
+	sort.Ints(sizes)
+	return sizes
+}
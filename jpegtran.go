@@ -0,0 +1,79 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"strconv"
+)
+
+// Rotates JPEGs by moving their compressed blocks around rather than decoding
+// and re-encoding them, so nothing is lost. Only used for JPEG to JPEG
+// conversions that do nothing but rotate, optimize the Huffman tables or add
+// restart markers, all of which it can do without touching the pixels. With
+// -perfect it fails on images whose size isn't a multiple of the block size,
+// which can't be rotated losslessly, in which case ImageMagick is fallen
+// back on
+var jpegtranConverter = &converter{
+	name:       "jpegtran",
+	args:       jpegtranArgs,
+	supports:   jpegtranSupports,
+	lossless:   true,
+	inFormats:  []string{ "jpg" },
+	outFormats: []string{ "jpg" },
+}
+
+func jpegtranSupports(j *job) bool {
+	o := *j.opts
+	o.rotate = 0
+	o.optimizeCoding = false
+	o.restartInterval = 0
+
+	return (j.opts.rotate != 0 || j.opts.tunesJpeg(j.formatOut)) && j.w <= 0 && j.h <= 0 && o.quality == 0 &&
+		!o.needsMagick() && !o.needsBackend()
+}
+
+func jpegtranArgs(j *job) []string {
+	args := []string{
+		"-copy", "all",
+		"-perfect",
+	}
+
+	if j.opts.rotate != 0 {
+		args = append(args, "-rotate", strconv.Itoa(j.opts.rotate))
+	}
+
+	if j.opts.optimizeCoding {
+		args = append(args, "-optimize")
+	}
+
+	if j.opts.restartInterval > 0 {
+		args = append(args, "-restart", strconv.Itoa(j.opts.restartInterval))
+	}
+
+	// jpegtran reads stdin unless given a file
+	if j.input != "-" {
+		args = append(args, j.input)
+	}
+
+	return args
+}
@@ -0,0 +1,60 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"io"
+)
+
+// LazyConvert does the same as Convert, but nothing happens until the
+// returned reader is first read from. This avoids reading the input and
+// starting a backend for results that end up never being used, such as
+// thumbnails that turn out to already be cached. As a result, any error
+// (including invalid options) is only returned from that first Read, and
+// from every Read after it. Unlike Convert, the original image isn't handed
+// back on failure
+func LazyConvert(data io.Reader, w int, h int, format string, opts ...Option) io.Reader {
+	return &lazyReader{
+		convert: func() (io.Reader, error) {
+			return Convert(data, w, h, format, opts...)
+		},
+	}
+}
+
+// lazyReader runs convert on its first read, then reads from the result
+type lazyReader struct {
+	convert func() (io.Reader, error)
+	r       io.Reader
+	err     error
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.convert != nil {
+		l.r, l.err = l.convert()
+		l.convert = nil
+	}
+
+	if l.err != nil { return 0, l.err }
+
+	return l.r.Read(p)
+}
@@ -0,0 +1,169 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// The largest width or height cairo can draw, which rsvg-convert and
+	// Inkscape render with
+	maxDimension = 32767
+
+	// The most pixels a backend is asked to render, SVGs included. Past this
+	// the backends tend to run out of memory or hit ImageMagick's policy
+	// limits, failing with errors that make little sense
+	maxPixels = 256 << 20
+
+	// The largest image ImageMagick renders SVGs to before resizing them, when
+	// the density is only there for quality. Oversampling beyond this doesn't
+	// visibly help and costs a lot of memory
+	maxIntermediate = 64 << 20
+)
+
+// ErrTooLarge is returned when a conversion would need an image larger than
+// the backends can handle
+var ErrTooLarge = errors.New("image would be too large to render")
+
+// checkLimits makes sure j won't ask a backend to render something larger
+// than it can, so a clear error can be given before starting it
+func checkLimits(j *job) error {
+	if j.w > 0 && j.h > 0 && int64(j.w)*int64(j.h) > maxPixels {
+		return tooLarge(j.w, j.h)
+	}
+
+	if j.formatIn != "svg" { return nil }
+
+	if j.w > maxDimension || j.h > maxDimension {
+		return tooLarge(j.w, j.h)
+	}
+
+	// A zoom gives the exact size rendered before any resizing
+	if j.opts.zoom > 0 && j.svgW > 0 && j.svgH > 0 {
+		rw := int64(math.Ceil(float64(j.svgW) * j.opts.zoom))
+		rh := int64(math.Ceil(float64(j.svgH) * j.opts.zoom))
+
+		if rw > maxDimension || rh > maxDimension || rw*rh > maxPixels {
+			return tooLarge(int(rw), int(rh))
+		}
+	}
+
+	return nil
+}
+
+func tooLarge(w int, h int) error {
+	return fmt.Errorf("%w: %dx%d is over the limit of %d pixels per side or %d pixels in total",
+		ErrTooLarge, w, h, maxDimension, maxPixels)
+}
+
+// svgDensity returns the density ImageMagick should render the SVG of j at,
+// or 0 to leave it at ImageMagick's default
+func svgDensity(j *job) float64 {
+	if j.density > 0 { return j.density }
+	if j.opts.zoom > 0 { return svgDPI * j.opts.zoom }
+	if j.w <= 0 || j.h <= 0 { return 0 }
+
+	// The DPI for convert is set to 3072 because it's the ideal DPI for
+	// converting a 16x16 SVG image to 512x512, which feels like a reasonable
+	// medium, especially because ImageMagick is less than ideal for converting
+	// SVGs anyway. If w and h set to -1, the density will not be changed
+	density := 3072.0
+
+	if j.svgW <= 0 || j.svgH <= 0 { return density }
+
+	// Large SVGs at that density would need an enormous image to be rendered
+	// before being resized, so bring it down to the most that fits within the
+	// limits. It's never brought below what's needed to reach the resolution
+	w, h := float64(j.svgW), float64(j.svgH)
+	limit := svgDPI * math.Min(maxDimension/math.Max(w, h), math.Sqrt(maxIntermediate/(w*h)))
+
+	scale := math.Min(float64(j.w)/w, float64(j.h)/h)
+	if j.opts.resize == ResizeFill || j.opts.resize == ResizeStretch {
+		scale = math.Max(float64(j.w)/w, float64(j.h)/h)
+	}
+	needed := svgDPI * scale
+
+	return math.Min(density, math.Max(limit, needed))
+}
+
+// Programs that are part of ImageMagick, which are given resource limits
+// through their args and environment rather than ulimit, as ImageMagick can
+// work within them instead of just being killed
+var magickPrograms = []string{ "convert", "identify", "montage", "magick" }
+
+// magickLimits returns the -limit args for ImageMagick from the options
+func magickLimits(o *options) []string {
+	var args []string
+
+	if o.threads > 0 {
+		args = append(args, "-limit", "thread", strconv.Itoa(o.threads))
+	}
+
+	if o.memoryLimit > 0 {
+		n := strconv.FormatInt(o.memoryLimit, 10)
+		args = append(args, "-limit", "memory", n, "-limit", "map", n)
+	}
+
+	if o.cpuLimit > 0 {
+		args = append(args, "-limit", "time", strconv.Itoa(cpuSeconds(o.cpuLimit)))
+	}
+
+	return args
+}
+
+// limitCmd returns the command and args to run a backend with, wrapping it in
+// a shell that sets ulimits if the options limit resources and it isn't part
+// of ImageMagick. If there's no shell the backend is run without them
+func limitCmd(convCmd string, convArgs []string, o *options) (string, []string) {
+	if o.memoryLimit <= 0 && o.cpuLimit <= 0 { return convCmd, convArgs }
+	if contains(magickPrograms, filepath.Base(convCmd)) { return convCmd, convArgs }
+
+	sh, err := findProgram("sh")
+	if err != nil {
+		o.log("no shell to set resource limits with, running without them", "cmd", convCmd)
+		return convCmd, convArgs
+	}
+
+	script := ""
+	if o.memoryLimit > 0 {
+		// ulimit -v takes kibibytes
+		script += "ulimit -v " + strconv.FormatInt((o.memoryLimit+1023)/1024, 10) + " && "
+	}
+	if o.cpuLimit > 0 {
+		script += "ulimit -t " + strconv.Itoa(cpuSeconds(o.cpuLimit)) + " && "
+	}
+
+	// The backend becomes $0 and its args $@, so nothing needs quoting
+	return sh, append([]string{ "-c", script + `exec "$0" "$@"`, convCmd }, convArgs...)
+}
+
+// cpuSeconds rounds d up to whole seconds, as that's all the limits take
+func cpuSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
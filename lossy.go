@@ -0,0 +1,68 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+var (
+	// Formats whose encoders throw away detail to save space, at least with
+	// the settings the backends use by default
+	lossyFormats = []string{
+		"jpg", "webp", "heic", "heif", "bpg", "jp2", "jpf", "jxl",
+	}
+
+	// Formats limited to a palette of 256 colors
+	paletteFormats = []string{
+		"gif", "xpm", "png8",
+	}
+
+	// Formats that describe shapes rather than pixels, which are lost once
+	// they've been rendered
+	vectorFormats = []string{
+		"svg", "pdf", "ps", "eps",
+	}
+)
+
+// IsLossy reports whether converting an image from one format to another can
+// lose data, going by what the formats are able to store. That's the case
+// when writing lossy formats such as JPEG or WebP (re-encoding them
+// included), reducing an image to a palette, as with GIF, or rendering a
+// vector image to pixels. Resizing is not taken into account
+func IsLossy(from string, to string) bool {
+	if contains(lossyFormats, to) { return true }
+
+	if contains(paletteFormats, to) && !contains(paletteFormats, from) {
+		return true
+	}
+
+	return contains(vectorFormats, from) && !contains(vectorFormats, to)
+}
+
+// isLossy does the same as IsLossy for j, also taking the options into
+// account
+func isLossy(j *job) bool {
+	if j.formatOut == "dds" && j.opts.blockFormat != "" { return true }
+
+	if j.formatOut == "webp" && contains(j.opts.defines, "webp:lossless=true") {
+		return contains(vectorFormats, j.formatIn)
+	}
+
+	return IsLossy(j.formatIn, j.formatOut)
+}
@@ -0,0 +1,162 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+// MIME types of the formats that can be written
+var formatMimes = map[string]string{
+	"png":  "image/png",
+	"png8": "image/png",
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"bmp":  "image/bmp",
+	"ico":  "image/vnd.microsoft.icon",
+	"icns": "image/x-icns",
+	"svg":  "image/svg+xml",
+	"tiff": "image/tiff",
+	"tga":  "image/x-tga",
+	"xpm":  "image/x-xpixmap",
+	"jxl":  "image/jxl",
+	"jp2":  "image/jp2",
+	"jpf":  "image/jpx",
+	"heic": "image/heic",
+	"heif": "image/heif",
+	"bpg":  "image/bpg",
+	"hdr":  "image/vnd.radiance",
+	"pdf":  "application/pdf",
+	"ps":   "application/postscript",
+	"eps":  "application/postscript",
+	"dds":  "image/vnd-ms.dds",
+	"ktx":  "image/ktx",
+	"ktx2": "image/ktx2",
+}
+
+// Image formats that the mimetype library doesn't detect, along with
+// functions to check whether the start of a file is one of them
+var extraMagic = []struct {
+	format string
+	match  func(head []byte) bool
+}{
+	{ "tga", isTGA },
+	{ "jxl", isJXL },
+	{ "jp2", isJPEG2000("jp2 ") },
+	{ "jpf", isJPEG2000("jpx ") },
+	{ "dds", hasPrefix("DDS ") },
+	{ "ktx", hasPrefix("\xabKTX 11\xbb\r\n\x1a\n") },
+	{ "ktx2", hasPrefix("\xabKTX 20\xbb\r\n\x1a\n") },
+}
+
+// detectExtra returns the format of head if it's one of the formats in
+// extraMagic, otherwise an empty string
+func detectExtra(head []byte) string {
+	for _, m := range extraMagic {
+		if m.match(head) { return m.format }
+	}
+
+	return ""
+}
+
+// isICO checks that an image detected as an ICO by its magic also contains
+// at least one image, which TGAs sharing the same magic never do
+func isICO(head []byte) bool {
+	return len(head) >= 6 && (head[4] != 0 || head[5] != 0)
+}
+
+// isTGA checks whether head looks like the header of a Truevision TGA image.
+// TGA has no magic number (the v2 signature is in the footer), so this checks
+// that every field of the header has a sane value instead
+func isTGA(head []byte) bool {
+	if len(head) < 18 { return false }
+
+	colorMapType := head[1]
+	imageType    := head[2]
+	width        := int(head[12]) | int(head[13])<<8
+	height       := int(head[14]) | int(head[15])<<8
+	depth        := head[16]
+	descriptor   := head[17]
+
+	switch imageType {
+	case 1, 9:
+		// Color mapped images must have a color map
+		if colorMapType != 1 { return false }
+	case 2, 3, 10, 11:
+		if colorMapType > 1 { return false }
+	default:
+		return false
+	}
+
+	switch depth {
+	case 8, 15, 16, 24, 32:
+	default:
+		return false
+	}
+
+	// The top two bits of the descriptor are reserved
+	return width > 0 && height > 0 && descriptor&0xc0 == 0
+}
+
+// isJXL checks for either a bare JPEG XL codestream or one in a container,
+// in case the mimetype library is too old to know about them
+func isJXL(head []byte) bool {
+	return bytes.HasPrefix(head, []byte{ 0xff, 0x0a }) ||
+		bytes.HasPrefix(head, []byte("\x00\x00\x00\x0cJXL \r\n\x87\n"))
+}
+
+// isJPEG2000 returns a check for a JPEG 2000 file with the brand given in its
+// file type box, which tells JP2 and JPX apart
+func isJPEG2000(brand string) func(head []byte) bool {
+	return func(head []byte) bool {
+		return len(head) >= 24 &&
+			bytes.HasPrefix(head, []byte("\x00\x00\x00\x0cjP  \r\n\x87\n")) &&
+			string(head[16:20]) == "ftyp" && string(head[20:24]) == brand
+	}
+}
+
+// hasPrefix returns a check for formats that always start with magic
+func hasPrefix(magic string) func(head []byte) bool {
+	return func(head []byte) bool {
+		return bytes.HasPrefix(head, []byte(magic))
+	}
+}
+
+// isSVG checks whether the root element of the XML document starting with
+// head is <svg>. head may be cut off anywhere after the root element starts
+func isSVG(head []byte) bool {
+	d := xml.NewDecoder(bytes.NewReader(head))
+	d.Strict = false
+
+	for {
+		tok, err := d.RawToken()
+		if err != nil { return false }
+
+		if el, ok := tok.(xml.StartElement); ok {
+			return el.Name.Local == "svg"
+		}
+	}
+}
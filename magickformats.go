@@ -0,0 +1,132 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A line of `convert -list format`, eg: "      PNG* PNG       rw-   Portable
+// Network Graphics". ImageMagick 6 leaves out the module column, and a * marks
+// native blob support
+var magickFormatLine = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)\*?\s+(?:\S+\s+)?([r-])([w-])[+-]\s`)
+
+// magickFormats are the formats an installed ImageMagick can read and write,
+// which depends on the delegate libraries it was built with
+type magickFormats struct {
+	read  []string
+	write []string
+}
+
+// Formats listed by each ImageMagick binary, keyed by its path. Guarded by
+// cacheMu
+var magickFormatCache = make(map[string]*magickFormats)
+
+// magickConverter returns the converter for ImageMagick's name program, which
+// is convert for ImageMagick 6 and magick for 7. Both are kept, as when both
+// are installed they're often built with different delegates
+func magickConverter(name string) *converter {
+	return &converter{
+		name: name,
+		args: func(j *job) []string {
+			return magickArgs(j, j.formatOut+":-")
+		},
+		supports:   magickSupports,
+		handles:    magickHandles,
+		inFormats:  append(magickInFormats, rawFormats...),
+		outFormats: magickOutFormats,
+	}
+}
+
+// magickSupports checks whether ImageMagick can do everything j asks for
+func magickSupports(j *job) bool {
+	if j.formatOut == "dds" && j.opts.blockFormat != "" {
+		return blockFormats[j.opts.blockFormat].magick != ""
+	}
+
+	return true
+}
+
+// findMagick finds ImageMagick's tool (convert, identify or montage),
+// returning the program to run and the args that go before the tool's own.
+// ImageMagick 7 only installs the separate tools when asked to, leaving just
+// magick, which converts on its own and runs the other tools named first
+func findMagick(tool string) (string, []string, error) {
+	if path, err := findProgram(tool); err == nil { return path, nil, nil }
+
+	path, err := findProgram("magick")
+	if err != nil { return "", nil, err }
+
+	if tool == "convert" { return path, nil, nil }
+
+	return path, []string{ tool }, nil
+}
+
+// magickHandles checks the formats the ImageMagick at path lists, going by
+// the static tables alone if it can't list them
+func magickHandles(path string, from string, to string) bool {
+	f, err := listMagickFormats(path)
+	if err != nil || len(f.read) == 0 { return true }
+
+	return contains(f.read, from) && contains(f.write, to)
+}
+
+// listMagickFormats runs `-list format` on the ImageMagick at path, only
+// the first time for each path. Nothing is listed if its output couldn't be
+// made sense of
+func listMagickFormats(path string) (*magickFormats, error) {
+	cacheMu.Lock()
+	f, ok := magickFormatCache[path]
+	cacheMu.Unlock()
+	if ok { return f, nil }
+
+	out, err := run(path, []string{ "-list", "format" }, nil, &options{})
+	if err != nil { return nil, err }
+
+	f = parseMagickFormats(string(out))
+
+	cacheMu.Lock()
+	magickFormatCache[path] = f
+	cacheMu.Unlock()
+
+	return f, nil
+}
+
+// parseMagickFormats reads the output of `-list format`, naming formats the
+// way imgconv does. Lines that aren't formats, such as the header and
+// descriptions spilling onto another line, are skipped
+func parseMagickFormats(out string) *magickFormats {
+	f := &magickFormats{}
+
+	for _, line := range strings.Split(out, "\n") {
+		m := magickFormatLine.FindStringSubmatch(line)
+		if m == nil { continue }
+
+		name := strings.ToLower(m[1])
+		if m[2] == "r" { f.read = append(f.read, name) }
+		if m[3] == "w" { f.write = append(f.write, name) }
+	}
+
+	return f
+}
@@ -0,0 +1,72 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindMagick(t *testing.T) {
+	fakePrograms(t, map[string]string{ "magick": catScript, "montage": catScript })
+
+	tests := []struct {
+		tool string
+		cmd  string
+		args []string
+	}{
+		{ "convert",  "/fake/bin/magick",  nil },
+		{ "identify", "/fake/bin/magick",  []string{ "identify" } },
+		{ "montage",  "/fake/bin/montage", nil },
+	}
+
+	for _, test := range tests {
+		cmd, args, err := findMagick(test.tool)
+		if err != nil { t.Errorf("%s: %v", test.tool, err); continue }
+
+		if cmd != test.cmd || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: got %s %v, want %s %v", test.tool, cmd, args, test.cmd, test.args)
+		}
+	}
+}
+
+func TestFindMagickMissing(t *testing.T) {
+	fakePrograms(t, map[string]string{})
+
+	if _, _, err := findMagick("identify"); err == nil {
+		t.Error("found ImageMagick with nothing installed")
+	}
+}
+
+func TestPlaceOnMagick(t *testing.T) {
+	script, runs := loggingScript(t, testPNG(32, 32))
+	fakePrograms(t, map[string]string{ "magick": script })
+
+	_, err := PlaceOn(32, 32, "white", bytes.NewReader(testPNG(8, 8)), 4, 4, "png")
+	if err != nil { t.Fatal(err) }
+
+	if run := runs()[0]; !strings.HasPrefix(run, "-size 32x32 xc:white") {
+		t.Errorf("magick was run with %q, want convert's args", run)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// ApplyMask uses the grayscale mask as the alpha channel of base, so white
+// parts of the mask are kept opaque and black parts become transparent, as is
+// often needed when compositing UI elements. Any alpha base already had is
+// replaced. The mask is stretched to the size of base if they differ. The
+// result should be written in a format with an alpha channel, such as PNG or
+// WebP, or the mask is lost. This requires ImageMagick
+func ApplyMask(base io.Reader, mask io.Reader, format string, opts ...Option) (io.Reader, error) {
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	format, err = o.outputFormat(format, "")
+	if err != nil { return nil, err }
+
+	if !contains(magickOutFormats, format) {
+		return nil, errors.New("ImageMagick can't write " + format)
+	}
+
+	baseType, baseSrc, err := readInput(base, o)
+	defer baseSrc.remove()
+	if err != nil { return nil, err }
+
+	maskType, maskSrc, err := readInput(mask, o)
+	defer maskSrc.remove()
+	if err != nil { return nil, err }
+
+	for _, mimetype := range []string{ baseType, maskType } {
+		if !contains(magickInFormats, mimetype) {
+			return nil, errors.New("ImageMagick can't read " + mimetype)
+		}
+	}
+
+	cmd, sub, err := findMagick("convert")
+	if err != nil {
+		return nil, errors.New("ApplyMask requires ImageMagick to be installed")
+	}
+
+	w, h, err := probeSize(baseType, baseSrc, o)
+	if err != nil { return nil, err }
+
+	maskW, maskH, err := probeSize(maskType, maskSrc, o)
+	if err != nil { return nil, err }
+
+	// Only one of the images can be piped in
+	err = maskSrc.spill(maskType)
+	if err != nil { return nil, err }
+
+	maskArgs := []string{ maskSrc.input() }
+	if maskW != w || maskH != h {
+		o.log("resizing mask to match the base image",
+			"mask", strconv.Itoa(maskW)+"x"+strconv.Itoa(maskH),
+			"base", strconv.Itoa(w)+"x"+strconv.Itoa(h),
+		)
+
+		maskArgs = []string{
+			"(", maskSrc.input(), "-resize", strconv.Itoa(w) + "x" + strconv.Itoa(h) + "!", ")",
+		}
+	}
+
+	args := append(magickLimits(o), baseSrc.input())
+	args = append(args, maskArgs...)
+	args = append(args,
+		"-alpha", "off",
+		"-compose", "CopyOpacity",
+		"-composite",
+		format + ":-",
+	)
+
+	out, err := run(cmd, append(sub, args...), baseSrc, o)
+	if err != nil { return nil, err }
+
+	return bytes.NewReader(out), nil
+}
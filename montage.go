@@ -0,0 +1,146 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SkippedError is returned along with a valid result when some of the input
+// files had to be left out, such as files that aren't images
+type SkippedError struct {
+	Files []string // Paths of the skipped files
+}
+
+func (e *SkippedError) Error() string {
+	return "skipped " + strconv.Itoa(len(e.Files)) + " file(s) that couldn't be used: " +
+		strings.Join(e.Files, ", ")
+}
+
+// ContactSheet lays out every image in dir as a cols wide grid of thumbnails,
+// each fit inside cellW x cellH with its filename written underneath, which
+// is handy for looking over a whole icon set at once. Files are placed in
+// order of their names. Anything that isn't an image ImageMagick can read is
+// left out, in which case the sheet is still returned, along with a
+// *SkippedError listing what was left out. This requires ImageMagick's montage
+func ContactSheet(dir string, cols int, cellW int, cellH int, format string, opts ...Option) (io.Reader, error) {
+	if cols < 1 || cellW < 1 || cellH < 1 {
+		return nil, errors.New("columns and cell size must be above 0")
+	}
+
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	format, err = o.outputFormat(format, "")
+	if err != nil { return nil, err }
+
+	if !contains(magickOutFormats, format) {
+		return nil, errors.New("ImageMagick can't write " + format)
+	}
+
+	cmd, sub, err := findMagick("montage")
+	if err != nil {
+		return nil, errors.New("ContactSheet requires ImageMagick to be installed")
+	}
+
+	// ReadDir already sorts by filename
+	entries, err := os.ReadDir(dir)
+	if err != nil { return nil, err }
+
+	var files []string
+	skipped := &SkippedError{}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() { continue }
+
+		path := filepath.Join(dir, entry.Name())
+		if isMagickReadable(path) {
+			files = append(files, path)
+		} else {
+			skipped.Files = append(skipped.Files, path)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("no images found in " + dir)
+	}
+
+	args := []string{
+		"-label", "%f",
+		"-tile", strconv.Itoa(cols) + "x",
+		"-geometry", strconv.Itoa(cellW) + "x" + strconv.Itoa(cellH) + "+4+4",
+		"-background", "none",
+	}
+
+	args = append(args, magickLimits(o)...)
+
+	for _, file := range files {
+		args = append(args, magickFilename(file))
+	}
+	args = append(args, format+":-")
+
+	out, err := run(cmd, append(sub, args...), nil, o)
+	if err != nil { return nil, err }
+
+	if len(skipped.Files) > 0 {
+		return bytes.NewReader(out), skipped
+	}
+
+	return bytes.NewReader(out), nil
+}
+
+// magickFilename keeps ImageMagick from reading anything into the name of the
+// file at path. Relative paths are made to start with ./ so names like
+// "png:x" or "-x" aren't taken as a format or an option, and the characters
+// it expands like a glob or takes as selecting frames are escaped
+func magickFilename(path string) string {
+	if !filepath.IsAbs(path) { path = "." + string(filepath.Separator) + path }
+
+	return magickGlobEscaper.Replace(path)
+}
+
+// Escapes the characters ImageMagick expands in filenames
+var magickGlobEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"[", `\[`,
+	"]", `\]`,
+	"*", `\*`,
+	"?", `\?`,
+)
+
+// isMagickReadable checks whether the file at path is an image in a format
+// ImageMagick can read
+func isMagickReadable(path string) bool {
+	f, err := os.Open(path)
+	if err != nil { return false }
+	defer f.Close()
+
+	format, err := GetType(f)
+	return err == nil && contains(magickInFormats, format)
+}
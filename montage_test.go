@@ -0,0 +1,69 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// argsScript writes each of the args it's run with on its own line
+const argsScript = `for arg; do echo "$arg"; done`
+
+func TestMagickFilename(t *testing.T) {
+	tests := map[string]string{
+		"png:icon.png":   "./png:icon.png",
+		"-icon.png":      "./-icon.png",
+		"icon[0].png":    `./icon\[0\].png`,
+		"/icons/*.png":   `/icons/\*.png`,
+		"/icons/a?.png":  `/icons/a\?.png`,
+		`/icons/a\b.png`: `/icons/a\\b.png`,
+	}
+
+	for path, want := range tests {
+		if got := magickFilename(path); got != want {
+			t.Errorf("magickFilename(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestContactSheetFilenames(t *testing.T) {
+	fakePrograms(t, map[string]string{ "montage": argsScript })
+
+	dir := t.TempDir()
+	for _, name := range []string{ "a[1].png", "b*.png" } {
+		if err := os.WriteFile(filepath.Join(dir, name), testPNG(8, 8), 0644); err != nil { t.Fatal(err) }
+	}
+
+	r, err := ContactSheet(dir, 2, 16, 16, "png")
+	if err != nil { t.Fatal(err) }
+
+	out, _ := ioutil.ReadAll(r)
+	args := strings.Split(string(out), "\n")
+
+	for _, want := range []string{ filepath.Join(dir, `a\[1\].png`), filepath.Join(dir, `b\*.png`) } {
+		if !contains(args, want) { t.Errorf("montage wasn't given %q, got %q", want, args) }
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConvertMultiSize converts an image to several sizes at once, such as the
+// widths of a srcset, returning the results keyed by size. Each size is used
+// the same way as the maxRes of ConvertWithAspect. The input is only read
+// once, and SVGs are only rendered once, at the largest size, which is then
+// scaled down for the others
+func ConvertMultiSize(data io.Reader, sizes []int, format string, opts ...Option) (map[int]io.Reader, error) {
+	if len(sizes) == 0 {
+		return nil, errors.New("no sizes given")
+	}
+
+	largest := 0
+	for _, size := range sizes {
+		if size < 1 {
+			return nil, errors.New("sizes must be above 0")
+		}
+
+		if size > largest { largest = size }
+	}
+
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	format, err = o.outputFormat(format, "")
+	if err != nil { return nil, err }
+
+	mimetype, src, err := readInput(data, o, videoFormats...)
+	defer src.remove()
+	if err != nil { return nil, err }
+
+	// Every size of a raster image is just scaled to fit a square, letting
+	// the backend keep the aspect ratio. SVGs are sized as they come out,
+	// rotated or padded to a square
+	sw, sh := -1, -1
+	if mimetype == "svg" {
+		sw, sh, err = outputSize(mimetype, src, o)
+		if err != nil { return nil, err }
+	}
+
+	dims := func(size int) (int, int) {
+		if sw > 0 && sh > 0 && !o.squarePad { return scaleWithAspect(sw, sh, size) }
+		return size, size
+	}
+
+	// Render the SVG once at the largest size to a lossless raster, which
+	// every size is then made from. The render already has every edit made
+	// to it, so it's only scaled and encoded from then on
+	sizeOpts := o
+	if mimetype == "svg" && format != "svg" && len(sizes) > 1 {
+		w, h := dims(largest)
+
+		out, err := convert(src, mimetype, w, h, "png", o.editsOnly())
+		if err != nil { return nil, err }
+
+		b, err := io.ReadAll(out)
+		if err != nil { return nil, err }
+
+		src = &source{data: b}
+		mimetype = "png"
+		sizeOpts = o.encodingOnly()
+	}
+
+	results := make(map[int]io.Reader, len(sizes))
+	for _, size := range sizes {
+		if _, ok := results[size]; ok { continue }
+
+		w, h := dims(size)
+
+		out, err := convert(src, mimetype, w, h, format, sizeOpts)
+		if err != nil { return nil, err }
+
+		results[size] = out
+	}
+
+	return results, nil
+}
+
+// FormatErrors is returned by ConvertMultiFormat along with the formats that
+// did convert, holding why each of the others didn't
+type FormatErrors map[string]error
+
+func (e FormatErrors) Error() string {
+	formats := make([]string, 0, len(e))
+	for format := range e {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	msgs := make([]string, len(formats))
+	for i, format := range formats {
+		msgs[i] = format + ": " + e[format].Error()
+	}
+
+	return "failed to convert to " + strconv.Itoa(len(e)) + " format(s): " + strings.Join(msgs, "; ")
+}
+
+// ConvertMultiFormat converts an image to several formats at the same size,
+// such as a PNG and a WebP, returning the results keyed by format. The input
+// is only read once, and SVGs are only rendered once, to a lossless raster
+// which every other format is then written from. A format failing doesn't
+// stop the others: whatever converted is returned along with FormatErrors
+func ConvertMultiFormat(data io.Reader, w int, h int, formats []string, opts ...Option) (map[string]io.Reader, error) {
+	if len(formats) == 0 {
+		return nil, errors.New("no formats given")
+	}
+
+	if err := checkRes(w, h); err != nil { return nil, err }
+
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	mimetype, src, err := readInput(data, o, videoFormats...)
+	defer src.remove()
+	if err != nil { return nil, err }
+
+	rasters := 0
+	for _, format := range formats {
+		if format != "svg" { rasters++ }
+	}
+
+	// The render already has every edit made to it, so it's only encoded
+	// from then on. If it can't be made, each format is converted from the
+	// SVG instead, so they fail or not on their own
+	var render *source
+	if mimetype == "svg" && rasters > 1 {
+		b, err := renderPng(src, mimetype, w, h, o.editsOnly())
+		if err == nil {
+			render = &source{data: b}
+		} else {
+			o.log("rendering once for every format failed, converting each on its own", "error", err)
+		}
+	}
+
+	results := make(map[string]io.Reader, len(formats))
+	errs := make(FormatErrors)
+
+	for _, format := range formats {
+		if _, ok := results[format]; ok { continue }
+		if _, ok := errs[format]; ok { continue }
+
+		var out io.Reader
+		if render != nil && format != "svg" {
+			out, err = convert(render, "png", -1, -1, format, o.encodingOnly())
+		} else {
+			out, err = convert(src, mimetype, w, h, format, o)
+		}
+
+		if err != nil {
+			errs[format] = err
+			continue
+		}
+
+		results[format] = out
+	}
+
+	if len(errs) > 0 { return results, errs }
+
+	return results, nil
+}
+
+// renderPng converts src to a PNG, read into memory to be converted again
+func renderPng(src *source, mimetype string, w int, h int, o *options) ([]byte, error) {
+	out, err := convert(src, mimetype, w, h, "png", o)
+	if err != nil { return nil, err }
+
+	return io.ReadAll(out)
+}
@@ -0,0 +1,132 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"image"
+	_ "image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+// checkSizes checks that each of results is an image of the size wanted for
+// it
+func checkSizes(t *testing.T, results map[int]io.Reader, want map[int][2]int) {
+	t.Helper()
+
+	for size, dims := range want {
+		cfg, _, err := image.DecodeConfig(results[size])
+		if err != nil { t.Errorf("size %d: %v", size, err); continue }
+
+		if cfg.Width != dims[0] || cfg.Height != dims[1] {
+			t.Errorf("size %d is %dx%d, want %dx%d", size, cfg.Width, cfg.Height, dims[0], dims[1])
+		}
+	}
+}
+
+func TestConvertMultiSizeEditsOnce(t *testing.T) {
+	// testSVG is 16x8, so rotated it's rendered at 32x64 for the largest size
+	script, runs := loggingScript(t, testPNG(32, 64))
+	fakePrograms(t, map[string]string{ "convert": script })
+
+	results, err := ConvertMultiSize(strings.NewReader(testSVG), []int{ 16, 32, 64 }, "png",
+		WithRotate(90), WithTrim(), WithContrastStretch(1, 1), WithBackgroundPattern("checkerboard"))
+	if err != nil { t.Fatal(err) }
+
+	for _, edit := range []string{ "-rotate", "-trim", "-contrast-stretch" } {
+		n := 0
+		for _, run := range runs() {
+			if strings.Contains(run, edit) { n++ }
+		}
+
+		if n != 1 { t.Errorf("%s was done %d times, want once", edit, n) }
+	}
+
+	checkSizes(t, results, map[int][2]int{
+		16: { 8, 16 },
+		32: { 16, 32 },
+		64: { 32, 64 },
+	})
+}
+
+func TestConvertMultiSizeSquarePad(t *testing.T) {
+	script, _ := loggingScript(t, testPNG(64, 64))
+	fakePrograms(t, map[string]string{ "convert": script })
+
+	results, err := ConvertMultiSize(strings.NewReader(testSVG), []int{ 16, 64 }, "png", WithSquarePad("white"))
+	if err != nil { t.Fatal(err) }
+
+	checkSizes(t, results, map[int][2]int{
+		16: { 16, 16 },
+		64: { 64, 64 },
+	})
+}
+
+func TestConvertMultiSizePalette(t *testing.T) {
+	script, runs := loggingScript(t, testPNG(64, 32))
+	fakePrograms(t, map[string]string{ "convert": script })
+
+	results, err := ConvertMultiSize(strings.NewReader(testSVG), []int{ 16, 64 }, "gif", WithColors(16))
+	if err != nil { t.Fatal(err) }
+	if len(results) != 2 { t.Errorf("got %d sizes, want 2", len(results)) }
+
+	for _, run := range runs() {
+		if strings.Contains(run, "png:-") && strings.Contains(run, "-colors") {
+			t.Errorf("the render was run with %q, want the colors left to each size", run)
+		}
+	}
+}
+
+func TestConvertMultiFormatPalette(t *testing.T) {
+	script, runs := loggingScript(t, testPNG(64, 32))
+	fakePrograms(t, map[string]string{ "convert": script })
+
+	results, err := ConvertMultiFormat(strings.NewReader(testSVG), 64, 64, []string{ "gif", "png8" }, WithColors(16))
+	if err != nil { t.Fatal(err) }
+	if len(results) != 2 { t.Errorf("got %d formats, want 2", len(results)) }
+
+	for _, run := range runs() {
+		if strings.Contains(run, " png:-") && strings.Contains(run, "-colors") {
+			t.Errorf("the render was run with %q, want the colors left to each format", run)
+		}
+	}
+}
+
+func TestConvertMultiFormatRenderFails(t *testing.T) {
+	// Fails to render to PNG or write WebP, but writes anything else
+	script, _ := loggingScript(t, testPNG(64, 32))
+	fakePrograms(t, map[string]string{
+		"convert": `for arg; do case $arg in png:-|webp:-) echo "can't write $arg" >&2; exit 1;; esac; done; ` + script,
+	})
+
+	results, err := ConvertMultiFormat(strings.NewReader(testSVG), 64, 64, []string{ "gif", "jpg", "webp" })
+
+	errs, ok := err.(FormatErrors)
+	if !ok { t.Fatalf("got %v, want FormatErrors", err) }
+
+	if len(errs) != 1 || errs["webp"] == nil { t.Errorf("got errors %v, want only webp to fail", errs) }
+
+	for _, format := range []string{ "gif", "jpg" } {
+		if results[format] == nil { t.Errorf("%s wasn't converted", format) }
+	}
+}
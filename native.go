@@ -0,0 +1,300 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+)
+
+// Formats Go can read and write by itself
+var goFormats = []string{
+	"png", "jpg", "gif",
+}
+
+// The built-in converter, used for conversions between the formats Go can
+// handle by itself. It's preferred over everything else as it saves starting
+// a process, and doesn't depend on anything being installed
+var goConverter = &converter{
+	name:       "go",
+	inFormats:  goFormats,
+	outFormats: goFormats,
+	supports:   goSupports,
+	convert:    goConvert,
+}
+
+// goSupports checks whether j can be done without any external program
+func goSupports(j *job) bool {
+	// Decoding only keeps the first frame of a GIF, so leave animations to
+	// ImageMagick rather than silently dropping frames
+	if j.formatIn == "gif" && j.formatOut == "gif" { return false }
+
+	// Go's GIF encoder has no way of writing comments
+	if j.opts.comment != "" && j.formatOut == "gif" { return false }
+
+	// Nor can its JPEG encoder optimize tables or write restart markers
+	if j.opts.tunesJpeg(j.formatOut) { return false }
+
+	// Go decodes CMYK JPEGs, but has no way of converting them to RGB with
+	// the right colors
+	if j.cmyk { return false }
+
+	return !j.opts.needsBackend()
+}
+
+func goConvert(j *job, r io.Reader) ([]byte, error) {
+	img, _, err := image.Decode(r)
+	if err != nil { return nil, err }
+
+	if j.opts.trim {
+		img, err = trim(img, j.opts.fuzz)
+		if err != nil { return nil, err }
+	}
+
+	if j.opts.stretch {
+		img = stretchLevels(img, j.opts.stretchBlack, j.opts.stretchWhite)
+	}
+
+	if j.w > 0 && j.h > 0 {
+		w, h := j.w, j.h
+		if j.opts.resize != ResizeStretch {
+			b := img.Bounds()
+			w, h = fitSize(b.Dx(), b.Dy(), j.w, j.h)
+		}
+
+		img = resize(img, w, h)
+	}
+
+	out, err := encode(img, j.formatOut, j.opts.quality)
+	if err != nil || j.opts.comment == "" { return out, err }
+
+	return addComment(out, j.formatOut, j.opts.comment)
+}
+
+// encode writes img in format, which must be one of goFormats. quality is
+// only used by JPEGs, 0 for the default
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	var b bytes.Buffer
+	var err error
+
+	switch format {
+	case "png":
+		err = png.Encode(&b, img)
+	case "jpg":
+		// JPEGs have no transparency, so flatten onto white instead of letting
+		// transparent areas come out black
+		if quality == 0 { quality = 92 }
+		err = jpeg.Encode(&b, flatten(img, color.White), &jpeg.Options{ Quality: quality })
+	case "gif":
+		err = gif.Encode(&b, img, nil)
+	default:
+		err = errors.New("go: unable to encode " + format)
+	}
+
+	return b.Bytes(), err
+}
+
+// fitSize scales w x h to fit within maxW x maxH while keeping its aspect
+// ratio, the same as ImageMagick's -resize
+func fitSize(w int, h int, maxW int, maxH int) (int, int) {
+	scale := math.Min(float64(maxW)/float64(w), float64(maxH)/float64(h))
+
+	fw := int(math.Round(float64(w) * scale))
+	fh := int(math.Round(float64(h) * scale))
+	if fw < 1 { fw = 1 }
+	if fh < 1 { fh = 1 }
+
+	return fw, fh
+}
+
+// flatten draws img over a solid background
+func flatten(img image.Image, bg color.Color) image.Image {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	draw.Draw(out, b, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(out, b, img, b.Min, draw.Over)
+
+	return out
+}
+
+// toNRGBA returns img as an NRGBA image with its origin at 0,0
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	if n, ok := img.(*image.NRGBA); ok && b.Min == (image.Point{}) {
+		return n
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+
+	return out
+}
+
+// stretchLevels stretches the levels of img so the darkest black percent of
+// its values become black and the lightest white percent become white, the
+// same as ImageMagick's -contrast-stretch. One set of levels is used for all
+// channels so colors don't shift, and transparent pixels are left out
+func stretchLevels(img image.Image, black float64, white float64) *image.NRGBA {
+	n := toNRGBA(img)
+
+	var hist [256]int
+	total := 0
+
+	for i := 0; i < len(n.Pix); i += 4 {
+		if n.Pix[i+3] == 0 { continue }
+
+		hist[n.Pix[i]]++
+		hist[n.Pix[i+1]]++
+		hist[n.Pix[i+2]]++
+		total += 3
+	}
+
+	lo, sum := 0, 0
+	for lo < 255 && float64(sum+hist[lo]) <= float64(total)*black/100 {
+		sum += hist[lo]
+		lo++
+	}
+
+	hi, sum := 255, 0
+	for hi > 0 && float64(sum+hist[hi]) <= float64(total)*white/100 {
+		sum += hist[hi]
+		hi--
+	}
+
+	if hi <= lo { return n }
+
+	var levels [256]uint8
+	for i := range levels {
+		levels[i] = clampByte(float64(i-lo) * 255 / float64(hi-lo))
+	}
+
+	for i := 0; i < len(n.Pix); i += 4 {
+		n.Pix[i]   = levels[n.Pix[i]]
+		n.Pix[i+1] = levels[n.Pix[i+1]]
+		n.Pix[i+2] = levels[n.Pix[i+2]]
+	}
+
+	return n
+}
+
+// A source pixel contributing to a destination pixel, and by how much
+type contrib struct {
+	i int
+	w float64
+}
+
+// resize scales img to w x h. When shrinking, each pixel is the average of the
+// source pixels it covers, and when enlarging it's interpolated between the
+// nearest ones. Colors are weighted by their alpha so transparent pixels
+// don't bleed into their neighbors
+func resize(img image.Image, w int, h int) *image.NRGBA {
+	src := toNRGBA(img)
+	sb := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	xs := contribs(sb.Dx(), w)
+	ys := contribs(sb.Dy(), h)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, b, a float64
+
+			for _, cy := range ys[y] {
+				row := src.Pix[cy.i*src.Stride:]
+
+				for _, cx := range xs[x] {
+					p := row[cx.i*4 : cx.i*4+4]
+					weight := cy.w * cx.w * float64(p[3])
+
+					r += float64(p[0]) * weight
+					g += float64(p[1]) * weight
+					b += float64(p[2]) * weight
+					a += weight
+				}
+			}
+
+			if a == 0 { continue }
+
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0] = clampByte(r / a)
+			d[1] = clampByte(g / a)
+			d[2] = clampByte(b / a)
+			d[3] = clampByte(a)
+		}
+	}
+
+	return dst
+}
+
+// contribs works out which source pixels make up each destination pixel
+// along one axis, scaling from srcLen to dstLen
+func contribs(srcLen int, dstLen int) [][]contrib {
+	out := make([][]contrib, dstLen)
+	scale := float64(srcLen) / float64(dstLen)
+
+	for i := range out {
+		if scale > 1 {
+			// Shrinking, average everything this pixel covers
+			start := float64(i) * scale
+			end := start + scale
+
+			for s := int(start); s < srcLen && float64(s) < end; s++ {
+				overlap := math.Min(end, float64(s+1)) - math.Max(start, float64(s))
+				if overlap > 0 {
+					out[i] = append(out[i], contrib{ s, overlap / scale })
+				}
+			}
+		} else {
+			// Enlarging, interpolate between the two closest pixels
+			center := (float64(i)+0.5)*scale - 0.5
+			s := int(math.Floor(center))
+			frac := center - float64(s)
+
+			out[i] = []contrib{
+				{ clampInt(s, 0, srcLen-1), 1 - frac },
+				{ clampInt(s+1, 0, srcLen-1), frac },
+			}
+		}
+	}
+
+	return out
+}
+
+func clampByte(f float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(f))))
+}
+
+func clampInt(i int, min int, max int) int {
+	if i < min { return min }
+	if i > max { return max }
+
+	return i
+}
@@ -0,0 +1,1240 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// The width and height SVGs that don't specify a size are treated as
+const defaultSvgSize = 512
+
+// Compression types accepted by WithCompression, as ImageMagick spells them
+var compressionTypes = []string{
+	"None", "RLE", "Zip", "LZW", "JPEG", "Group4",
+}
+
+// Dithering methods accepted by WithDither, as ImageMagick spells them
+var ditherMethods = []string{
+	"FloydSteinberg", "Riemersma", "None",
+}
+
+// Layer methods accepted by WithLayers, as ImageMagick spells them. The first
+// ones are done before resizing, and the rest after
+var layerMethods = []string{
+	"Coalesce", "Dispose",
+	"Optimize", "OptimizeFrame", "OptimizePlus", "OptimizeTransparency",
+	"CompareAny", "CompareClear", "CompareOverlay", "RemoveDups", "RemoveZero",
+}
+
+// Resampling filters accepted by WithFilter, as ImageMagick spells them
+var resizeFilters = []string{
+	"Point", "Box", "Triangle", "Hermite", "Gaussian", "Catrom", "Mitchell",
+	"Lanczos", "LanczosSharp", "Lanczos2", "Lanczos2Sharp", "Robidoux",
+	"RobidouxSharp", "Spline",
+}
+
+// Gravities accepted by WithGravity, as ImageMagick spells them
+var gravities = []string{
+	"NorthWest", "North", "NorthEast",
+	"West",      "Center", "East",
+	"SouthWest", "South", "SouthEast",
+}
+
+// The output format used when none is given, see SetDefaultFormat
+var defaultFormat atomic.Value
+
+// Extensions that are spelled differently from the format they're written as
+var extFormats = map[string]string{
+	"jpeg": "jpg",
+	"tif":  "tiff",
+}
+
+// Shape of format names. Anything else could be taken by ImageMagick as part
+// of a filename, a read modifier or another coder (eg: msl: or https:)
+var formatName = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// Shape of ImageMagick define keys, eg: webp:method or png:exclude-chunk
+var defineKey = regexp.MustCompile(`^[A-Za-z0-9]+(:[A-Za-z0-9_-]+)+$`)
+
+// Option changes how a conversion is done. Any number of them can be passed
+// as the trailing arguments of Convert and friends
+type Option func(*options)
+
+type options struct {
+	spillThreshold  int64    // Inputs larger than this are written to disk
+	keepLibraryPath bool     // Pass LD_LIBRARY_PATH through to backends
+	defines         []string // ImageMagick -define key=value pairs
+	threads         int      // Max threads per backend, 0 for no limit
+	compression     string   // ImageMagick -compress type
+	skipIfMatches   bool     // Return the input as-is if it's already suitable
+	forceReencode   bool     // Always convert, overriding skipIfMatches
+	zoom            float64  // Scale to render SVGs at, 0 if unset
+	pageW           float64  // Page size of vector output, in pageUnit
+	pageH           float64
+	pageUnit        string   // Unit of the page size, "" if unset
+	logger          Logger   // Where to report what's going on, nil for nowhere
+	resize          ResizeMode // How the image is made to fit the resolution
+	resizeSet       bool     // The resize mode was chosen by the caller
+	gravity         string   // Where the image sits when filling or padding
+	env             []string // Extra KEY=value variables for the backend
+	info            *ConvertInfo // Filled in with how the conversion was done
+	dpi             float64  // Resolution to store in the output's metadata
+	forceRender     bool     // Render SVG to SVG conversions instead of editing
+	selectFrame     bool     // Extract a single page, frame or layer of the input
+	frame           int      // Page, frame or layer to extract
+	trim            bool     // Crop away borders the same color as the corner
+	fuzz            float64  // How different trimmed colors can be, in percent
+	sanitizeSvg     bool     // Strip scripts and external references from SVGs
+	rejectUnsafeSvg bool     // Fail on SVGs with scripts or external references
+	nameFunc        func(src string) string // Names the outputs of ConvertDir
+	defaultFormat   string   // Output format if none is given, "" for the global one
+	progress        func(written int64) // Told how much ConvertStream has written
+	inputFormat     string   // Format of the input, "" to detect it
+	inputW          int      // Size of raw pixel input
+	inputH          int
+	comment         string   // Comment to store in the output's metadata
+	svgW            int      // Size of SVGs that don't specify one, 0 for the default
+	svgH            int
+	preprocess      []func(io.Reader) (io.Reader, error) // Run on the input first
+	squarePad       bool     // Pad the output to a square
+	squareBg        string   // Color to pad squares with
+	maxInput        int64    // Largest input accepted, 0 for no limit
+	colors          int      // Size of the palette, 0 for the format's default
+	errorSummary    bool     // Whether backend errors only give a summary
+	closeFile       bool     // Whether ConvertToFile closes the file
+	quality         int      // Quality of lossy output, 0 for the default
+	effort          int      // How hard JPEG XL encoding tries, 0 for the default
+	wholeIcns       bool     // Keep ICNS input whole instead of taking its largest image
+	memoryLimit     int64    // Bytes of memory a backend may use, 0 for no limit
+	cpuLimit        time.Duration // CPU time a backend may use, 0 for no limit
+	rotate          int      // Degrees to rotate clockwise, 0, 90, 180 or 270
+	dither          string   // How colors are dithered when reduced, "" for the default
+	optimizeCoding  bool     // Whether JPEGs get Huffman tables made for the image
+	restartInterval int      // MCU rows between JPEG restart markers, 0 for none
+	webpMethod      int      // WebP compression method, 0 (fastest) to 6
+	hasWebpMethod   bool     // Whether webpMethod was given
+	streamInput     bool     // Whether the input is passed through without buffering
+	bgPattern       string   // Pattern drawn behind the image, "" for none
+	depth           int      // Bits per channel of the output, 0 for the default
+	retries         int      // Times a failed backend is run again
+	retryBackoff    time.Duration // Wait before the first retry, doubled for each after
+	stretch         bool     // Whether the levels are stretched
+	stretchBlack    float64  // Percent of the darkest values made black when stretching
+	stretchWhite    float64  // Percent of the lightest values made white
+	strictFormat    bool     // Whether a given input format must match the detected one
+	filter          string   // ImageMagick's resampling filter, "" for the default
+	layers          string   // ImageMagick layer method used on animations, "" for none
+	smartCrop       bool     // Whether to keep what draws the eye when filling
+	blockFormat     string   // Block compression format of DDS output, "" for the default
+	linearResize    bool     // Whether to resize in linear light
+	ctx             context.Context // Cancels the conversion, nil if it can't be
+
+	// Options can't return errors themselves, so the first invalid one
+	// stores its error here to be returned once all have been applied
+	err error
+}
+
+// ResizeMode decides how an image is made to fit the requested resolution
+type ResizeMode int
+
+const (
+	// ResizeFit scales the image to fit within the resolution, keeping its
+	// aspect ratio, so one side can end up smaller than asked for. This is
+	// the default
+	ResizeFit ResizeMode = iota
+
+	// ResizeFill scales the image to cover the resolution, keeping its aspect
+	// ratio, and crops off whatever sticks out
+	ResizeFill
+
+	// ResizePad scales the image to fit within the resolution, keeping its
+	// aspect ratio, and pads the rest with transparency
+	ResizePad
+
+	// ResizeStretch scales the image to exactly the resolution, stretching
+	// it if its aspect ratio doesn't match
+	ResizeStretch
+)
+
+// Logger receives messages about what a conversion is doing, such as which
+// backend was picked, the exact command run, how long it took and what it
+// wrote to stderr if it failed. keyvals alternate between string keys and
+// their values, eg: Log("running backend", "backend", "convert", "args", ...)
+type Logger interface {
+	Log(msg string, keyvals ...interface{})
+}
+
+// ConvertInfo describes how a conversion was done, see WithInfo
+type ConvertInfo struct {
+	// Name of the backend that did the conversion, eg: "rsvg-convert". The
+	// built-in converter, used when no external program is needed, is "go"
+	Backend string
+
+	// Arguments the backend was run with, nil for the built-in converter
+	Args []string
+
+	// If ImageMagick ran out of memory rendering an SVG and had to fall back
+	// to a lower density, this is the density it ended up using. 0 otherwise
+	FallbackDensity float64
+
+	// Whether the conversion may have lost data going by the formats
+	// involved, see IsLossy
+	Lossy bool
+}
+
+// getOptions applies opts on top of the defaults, returning an error if any of
+// them were invalid
+func getOptions(opts []Option) (*options, error) {
+	o := &options{}
+
+	for _, opt := range opts {
+		if opt != nil { opt(o) }
+	}
+
+	return o, o.err
+}
+
+// context returns the context the conversion is done in, see ConvertContext
+func (o *options) context() context.Context {
+	if o.ctx == nil { return context.Background() }
+
+	return o.ctx
+}
+
+// log passes a message on to the logger, if one was given
+func (o *options) log(msg string, keyvals ...interface{}) {
+	if o.logger != nil {
+		o.logger.Log(msg, keyvals...)
+	}
+}
+
+// needsMagick checks whether any of the options can only be done by
+// ImageMagick, as the SVG renderers can only render and resize
+func (o *options) needsMagick() bool {
+	return o.fillsOrPads() || o.dpi > 0 || o.selectFrame || o.trim || o.comment != "" ||
+		o.squarePad || o.rotate != 0 || o.bgPattern != "" || o.stretch || o.filter != "" ||
+		o.layers != "" || o.linearResize || o.depth > 0
+}
+
+// needsBackend checks whether any of the options need an external program,
+// ruling out the built-in converter
+func (o *options) needsBackend() bool {
+	return o.fillsOrPads() || o.dpi > 0 || o.selectFrame || len(o.defines) > 0 ||
+		o.compression != "" || o.squarePad || o.colors > 0 || o.rotate != 0 ||
+		o.dither != "" || o.bgPattern != "" || o.depth > 0 || o.filter != "" ||
+		o.layers != "" || o.linearResize
+}
+
+// fillsOrPads checks whether the resize mode is one that only ImageMagick
+// can do, as every backend can fit or stretch
+func (o *options) fillsOrPads() bool {
+	return o.resize == ResizeFill || o.resize == ResizePad
+}
+
+// defaultSvgSize returns the size given to SVGs that don't specify one
+func (o *options) defaultSvgSize() (int, int) {
+	if o.svgW > 0 && o.svgH > 0 { return o.svgW, o.svgH }
+
+	return defaultSvgSize, defaultSvgSize
+}
+
+// encodingOnly returns a copy of the options without anything that reads or
+// edits the image, for writing an image that's already been made into other
+// formats
+func (o *options) encodingOnly() *options {
+	c := *o
+
+	c.zoom, c.svgW, c.svgH = 0, 0, 0
+	c.resize, c.resizeSet, c.gravity = ResizeFit, false, ""
+	c.selectFrame, c.frame = false, 0
+	c.trim, c.fuzz = false, 0
+	c.inputFormat, c.inputW, c.inputH = "", 0, 0
+	c.preprocess = nil
+	c.sanitizeSvg, c.rejectUnsafeSvg = false, false
+	c.squarePad, c.squareBg = false, ""
+	c.rotate, c.bgPattern = 0, ""
+	c.stretch, c.smartCrop = false, false
+
+	return &c
+}
+
+// editsOnly returns a copy of the options without anything that only applies
+// to writing the output format, for rendering an image that's then written to
+// other formats with encodingOnly
+func (o *options) editsOnly() *options {
+	c := *o
+
+	c.colors, c.dither = 0, ""
+	c.pageW, c.pageH, c.pageUnit = 0, 0, ""
+	c.blockFormat, c.layers, c.depth = "", "", 0
+	c.quality, c.effort, c.compression = 0, 0, ""
+	c.optimizeCoding, c.restartInterval = false, 0
+	c.webpMethod, c.hasWebpMethod = 0, false
+	c.dpi, c.comment = 0, ""
+
+	return &c
+}
+
+// tunesJpeg checks whether any of the JPEG encoding options apply to writing
+// format, which only ImageMagick and jpegtran can do
+func (o *options) tunesJpeg(format string) bool {
+	return format == "jpg" && (o.optimizeCoding || o.restartInterval > 0)
+}
+
+// gravityName returns the gravity to pass to ImageMagick
+func (o *options) gravityName() string {
+	if o.gravity == "" { return "Center" }
+
+	return o.gravity
+}
+
+// outputFormat decides the format to write when converting to format (which
+// may be empty) at dest (which may also be empty). An explicit format comes
+// first, then the extension of dest, then the default of the options and
+// finally the one set with SetDefaultFormat
+func (o *options) outputFormat(format string, dest string) (string, error) {
+	if format == "" { format = formatFromPath(dest) }
+	if format == "" { format = o.defaultFormat }
+	if format == "" { format, _ = defaultFormat.Load().(string) }
+
+	if format == "" {
+		return "", errors.New("no output format given, and no default format is set")
+	}
+
+	// The format ends up in the args of backends, so anything that isn't
+	// known to be a plain format name is turned away before it gets there
+	if !isOutputFormat(format) {
+		return "", errors.New("unknown output format " + strconv.Quote(format))
+	}
+
+	return format, nil
+}
+
+// isOutputFormat checks whether format is one that any backend can write
+func isOutputFormat(format string) bool {
+	for _, conv := range converters {
+		if contains(conv.outFormats, format) { return true }
+	}
+
+	return false
+}
+
+// formatFromPath returns the format matching the extension of path, or an
+// empty string if it isn't one that can be written
+func formatFromPath(path string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if f, ok := extFormats[ext]; ok { ext = f }
+
+	if _, ok := formatMimes[ext]; ok || contains(magickOutFormats, ext) {
+		return ext
+	}
+
+	return ""
+}
+
+// fail records err as the reason the options are invalid, unless an earlier
+// option already failed
+func (o *options) fail(err error) {
+	if o.err == nil { o.err = err }
+}
+
+// WithSpillThreshold limits how much of the input is kept in memory. Inputs
+// of up to n bytes are buffered in memory as usual, while anything larger is
+// written to a temporary file for the backend to read from, which is removed
+// once the conversion is done. By default (or if n <= 0) inputs are never
+// written to disk
+func WithSpillThreshold(n int64) Option {
+	return func(o *options) {
+		o.spillThreshold = n
+	}
+}
+
+// WithLibraryPath passes LD_LIBRARY_PATH through to the backend. Normally it's
+// removed from the backend's environment (never our own) because when running
+// inside an AppImage it points to libraries the system's programs can't use
+func WithLibraryPath() Option {
+	return func(o *options) {
+		o.keepLibraryPath = true
+	}
+}
+
+// WithDefine passes a format-specific setting to ImageMagick as -define
+// key=value, eg: WithDefine("webp:method", "6") or
+// WithDefine("png:exclude-chunk", "date"). The key must be in ImageMagick's
+// format:option form. Other backends ignore it
+func WithDefine(key string, value string) Option {
+	return func(o *options) {
+		if !defineKey.MatchString(key) {
+			o.fail(errors.New("invalid define key \"" + key + "\"; must be in format:option form"))
+			return
+		}
+
+		if value == "" || strings.ContainsAny(value, "= \t\r\n") {
+			o.fail(errors.New("invalid value for define " + key))
+			return
+		}
+
+		o.defines = append(o.defines, key+"="+value)
+	}
+}
+
+// WithThreadLimit limits each backend to using n threads, useful when many
+// conversions are run at once and the parallelism comes from that instead.
+// This is passed to ImageMagick as -limit thread, and as MAGICK_THREAD_LIMIT
+// and OMP_NUM_THREADS in the environment of every backend
+func WithThreadLimit(n int) Option {
+	return func(o *options) {
+		if n < 1 {
+			o.fail(errors.New("thread limit must be at least 1"))
+			return
+		}
+
+		o.threads = n
+	}
+}
+
+// WithMemoryLimit limits how much memory each backend may use, so a
+// pathological input (eg: an SVG drawing a huge filter) can't take over the
+// machine. ImageMagick is given it as -limit memory and -limit map (and the
+// MAGICK_MEMORY_LIMIT and MAGICK_MAP_LIMIT environment variables), past which
+// it caches pixels on disk instead and fails if that runs out too. Every
+// other backend is run with its address space limited to it (ulimit -v), so
+// leave some headroom, as the program itself takes up space as well
+func WithMemoryLimit(bytes int64) Option {
+	return func(o *options) {
+		if bytes < 1 {
+			o.fail(errors.New("memory limit must be above 0"))
+			return
+		}
+
+		o.memoryLimit = bytes
+	}
+}
+
+// WithCPUTimeLimit limits how much CPU time each backend may use, rounded up
+// to the second. ImageMagick is given it as -limit time (and
+// MAGICK_TIME_LIMIT), and every other backend is killed once it's used that
+// much (ulimit -t). Unlike a timeout this doesn't count time spent waiting
+func WithCPUTimeLimit(d time.Duration) Option {
+	return func(o *options) {
+		if d <= 0 {
+			o.fail(errors.New("CPU time limit must be above 0"))
+			return
+		}
+
+		o.cpuLimit = d
+	}
+}
+
+// WithCompression sets the compression ImageMagick uses for formats that
+// support several, eg: "RLE" or "None" for BMP and TGA, or "Zip" and "LZW" for
+// TIFF. Accepted types are None, RLE, Zip, LZW, JPEG and Group4 (in any case).
+// Formats that don't support the type ignore it
+func WithCompression(method string) Option {
+	return func(o *options) {
+		for _, t := range compressionTypes {
+			if strings.EqualFold(t, method) {
+				o.compression = t
+				return
+			}
+		}
+
+		o.fail(errors.New("unknown compression type \"" + method + "\""))
+	}
+}
+
+// WithSkipIfMatches returns the input untouched, without starting a backend,
+// if it's already in the requested format and fits within the requested
+// resolution (or the native resolution was asked for). This avoids needlessly
+// re-encoding, which for lossy formats would also lose quality. If the
+// dimensions of the input can't be read it's always converted. Overridden by
+// WithForceReencode
+func WithSkipIfMatches() Option {
+	return func(o *options) {
+		o.skipIfMatches = true
+	}
+}
+
+// WithForceReencode always converts the input, even if it's already in the
+// requested format and size, such as to strip its metadata. This is already
+// what happens by default, so it's only needed to override WithSkipIfMatches
+// (eg: for a single call when it's in a shared set of options), which it does
+// no matter which of the two is given first
+func WithForceReencode() Option {
+	return func(o *options) {
+		o.forceReencode = true
+	}
+}
+
+// WithZoom renders SVGs at factor times their intrinsic size, which gives
+// exact control over vector scaling instead of relying on the density tricks
+// used to hit a resolution. It maps to rsvg-convert's --zoom, Inkscape's
+// --export-dpi and an equivalent density for ImageMagick. The zoom is meant to
+// be used with the native resolution (-1); if a resolution is given as well,
+// rsvg-convert and Inkscape render straight to it and ignore the zoom, while
+// ImageMagick renders at the zoom and then resizes to fit
+func WithZoom(factor float64) Option {
+	return func(o *options) {
+		if factor <= 0 {
+			o.fail(errors.New("zoom must be above 0"))
+			return
+		}
+
+		o.zoom = factor
+	}
+}
+
+// Units accepted by WithPageSize
+var pageUnits = []string{ "pt", "mm", "cm", "in", "px" }
+
+// WithPageSize sets the size of the page SVGs are written on as vector
+// formats (PDF, PostScript or EPS), in points ("pt"), millimeters ("mm"),
+// centimeters ("cm"), inches ("in") or CSS pixels ("px", 96 to the inch).
+// Sizes given in pixels otherwise end up as whatever physical size the
+// renderer assumes for them, while without either the SVG's own size is
+// kept. The image is scaled to fit the page, keeping its aspect ratio, and
+// the resolution passed alongside it is ignored. Using it with any other
+// output is an error. Requires rsvg-convert 2.52 or newer, as Inkscape can't
+// set the page size
+func WithPageSize(w float64, h float64, unit string) Option {
+	return func(o *options) {
+		if w <= 0 || h <= 0 {
+			o.fail(errors.New("page size must be above 0"))
+			return
+		}
+
+		if !contains(pageUnits, unit) {
+			o.fail(errors.New("unknown page size unit \"" + unit + "\""))
+			return
+		}
+
+		o.pageW, o.pageH, o.pageUnit = w, h, unit
+	}
+}
+
+// WithRenderDPI renders SVGs at dpi dots per inch, which is often more
+// natural than a size in pixels for SVGs meant for print. It maps to
+// Inkscape's --export-dpi and ImageMagick's -density, and rsvg-convert is
+// zoomed to match. SVG pixels are 96 to the inch, so this is the same as
+// WithZoom(dpi / 96), and the two replace each other. Like the zoom, it's
+// meant to be used with the native resolution. It doesn't store a resolution
+// in the output, see WithDPI for that
+func WithRenderDPI(dpi float64) Option {
+	return func(o *options) {
+		if dpi <= 0 {
+			o.fail(errors.New("render DPI must be above 0"))
+			return
+		}
+
+		o.zoom = dpi / svgDPI
+	}
+}
+
+// WithBlockCompression sets the block compression format DDS textures are
+// written with: BC1 (formerly DXT1) for opaque images, BC3 (DXT5) for ones
+// with alpha, or BC7 for the best quality of the three, which only texconv
+// can write. Names are accepted in any case. Without it, texconv keeps the
+// pixels uncompressed, while ImageMagick uses its own default. Using it with
+// any other output is an error
+func WithBlockCompression(format string) Option {
+	return func(o *options) {
+		format = strings.ToUpper(format)
+		if _, ok := blockFormats[format]; !ok {
+			o.fail(errors.New("unknown block compression format \"" + format + "\""))
+			return
+		}
+
+		o.blockFormat = format
+	}
+}
+
+// WithLogger reports what the conversion is doing to l. Nothing is logged
+// unless a logger is given
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithEnv sets environment variables for the backend, eg: MAGICK_TMPDIR or
+// MAGICK_MEMORY_LIMIT to keep ImageMagick in check when converting untrusted
+// images. These are only given to the backend, the environment of the calling
+// process is never changed. They're applied last, so they override anything
+// imgconv sets itself
+func WithEnv(env map[string]string) Option {
+	return func(o *options) {
+		for k, v := range env {
+			if k == "" || strings.ContainsAny(k, "=\x00") || strings.Contains(v, "\x00") {
+				o.fail(errors.New("invalid environment variable \"" + k + "\""))
+				return
+			}
+
+			o.env = append(o.env, k+"="+v)
+		}
+	}
+}
+
+// WithInfo fills in info with details of how the conversion was done, such as
+// which backend ended up doing it
+func WithInfo(info *ConvertInfo) Option {
+	return func(o *options) {
+		o.info = info
+	}
+}
+
+// WithDPI stores a resolution of dpi dots per inch in the output's metadata,
+// for print workflows. This doesn't change the pixels at all, it's unrelated
+// to the density SVGs are rendered at. Requires ImageMagick
+func WithDPI(dpi float64) Option {
+	return func(o *options) {
+		if dpi <= 0 {
+			o.fail(errors.New("DPI must be above 0"))
+			return
+		}
+
+		o.dpi = dpi
+	}
+}
+
+// WithForceRender makes SVG to SVG conversions go through rsvg-convert or
+// Inkscape, which rewrite (normalize) the whole file. By default only the size
+// of the root element is edited, keeping the rest of the file as it was
+func WithForceRender() Option {
+	return func(o *options) {
+		o.forceRender = true
+	}
+}
+
+// WithLayer extracts layer n (counting from 0) of a layered input such as a
+// PSD or XCF, instead of the flattened composite of every layer, which is
+// what's used by default. Layers are counted in the order ImageMagick reads
+// them; for PSDs that means 0 is the composite image stored in the file and
+// the actual layers start at 1. Selecting a layer requires ImageMagick, and
+// makes the input be written to a temporary file for it to read
+func WithLayer(n int) Option {
+	return WithPage(n)
+}
+
+// WithPage converts page n (counting from 0) of a multi-page input such as a
+// PDF or TIFF, or frame n of an animation such as a GIF, rather than the
+// first. Frames are taken as they're stored, so those that only update part
+// of the image aren't drawn over the ones before them (see Frames for that).
+// It's picked with ImageMagick's read modifier (input[n]), which can't be
+// used on stdin, so the input is always written to a temporary file first.
+// Requires ImageMagick
+func WithPage(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			o.fail(errors.New("page can't be negative"))
+			return
+		}
+
+		o.selectFrame = true
+		o.frame = n
+	}
+}
+
+// WithTrim crops away borders of the same color as the top left corner, such
+// as the transparent padding SVG icons are often drawn with, before the image
+// is resized. Trimming an image that's entirely one color fails with
+// ErrNothingToTrim. Done by ImageMagick's -trim, or in Go for conversions
+// between PNG, JPEG and GIF
+func WithTrim() Option {
+	return func(o *options) {
+		o.trim = true
+	}
+}
+
+// WithTrimFuzz trims the same as WithTrim, but also treats colors within
+// percent (0-100) of the border's color as part of the border, for near
+// uniform backgrounds such as those of scanned or JPEG compressed images
+func WithTrimFuzz(percent float64) Option {
+	return func(o *options) {
+		if percent < 0 || percent > 100 {
+			o.fail(errors.New("trim fuzz must be between 0 and 100"))
+			return
+		}
+
+		o.trim = true
+		o.fuzz = percent
+	}
+}
+
+// WithResizeMode sets how the image is made to fit the resolution, see
+// ResizeMode. Filling and padding require ImageMagick
+func WithResizeMode(mode ResizeMode) Option {
+	return func(o *options) {
+		if mode < ResizeFit || mode > ResizeStretch {
+			o.fail(errors.New("unknown resize mode"))
+			return
+		}
+
+		o.resize, o.resizeSet = mode, true
+	}
+}
+
+// WithExactSize scales the image to exactly the resolution given, stretching
+// it if its aspect ratio doesn't match, rather than fitting it within the
+// resolution as is done by default. It's the same as
+// WithResizeMode(ResizeStretch)
+func WithExactSize() Option {
+	return WithResizeMode(ResizeStretch)
+}
+
+// WithSmartCrop fills the resolution (see ResizeFill), keeping the part of
+// the image that draws the eye, such as faces, rather than whatever the
+// gravity says. This is done with libvips' vipsthumbnail, and without it the
+// image is cropped around its center by ImageMagick instead. Options that
+// need ImageMagick for anything else rule vipsthumbnail out as well
+func WithSmartCrop() Option {
+	return func(o *options) {
+		o.smartCrop = true
+		o.resize, o.resizeSet = ResizeFill, true
+	}
+}
+
+// WithGravity sets where the image sits within the resolution when padding,
+// and which part of it is kept when filling. Accepted gravities are NorthWest,
+// North, NorthEast, West, Center, East, SouthWest, South and SouthEast (in any
+// case), the default being Center
+func WithGravity(gravity string) Option {
+	return func(o *options) {
+		for _, g := range gravities {
+			if strings.EqualFold(g, gravity) {
+				o.gravity = g
+				return
+			}
+		}
+
+		o.fail(errors.New("unknown gravity \"" + gravity + "\""))
+	}
+}
+
+// WithSanitizeSVG runs SVG inputs through SanitizeSVG before converting them,
+// removing scripts and external references. Use this when converting SVGs
+// from untrusted sources, as some backends will fetch the files they refer to
+func WithSanitizeSVG() Option {
+	return func(o *options) {
+		o.sanitizeSvg = true
+	}
+}
+
+// WithRejectUnsafeSVG fails with an error wrapping ErrUnsafeSVG if an SVG
+// input contains anything SanitizeSVG would remove, instead of removing it
+func WithRejectUnsafeSVG() Option {
+	return func(o *options) {
+		o.rejectUnsafeSvg = true
+	}
+}
+
+// WithNameFunc names the outputs of ConvertDir with fn, which is given the
+// path of an input and returns the file name to write it to within the
+// destination directory. By default the input's name is kept, with its
+// extension swapped for the output format
+func WithNameFunc(fn func(src string) string) Option {
+	return func(o *options) {
+		o.nameFunc = fn
+	}
+}
+
+// WithDefaultFormat sets the output format used when an empty one is passed,
+// overriding the one set with SetDefaultFormat for this call
+func WithDefaultFormat(format string) Option {
+	return func(o *options) {
+		o.defaultFormat = format
+	}
+}
+
+// SetDefaultFormat sets the output format used by every function when an
+// empty one is passed, eg: Convert(r, 256, 256, ""). An explicit format always
+// wins, then functions writing to a file use its extension, then the format
+// given with WithDefaultFormat, then this one. Initially there's no default,
+// so an empty format is an error. It's safe to call at any time
+func SetDefaultFormat(format string) {
+	defaultFormat.Store(format)
+}
+
+// WithProgress calls fn with the total number of bytes written so far every
+// time ConvertStream writes part of the output, eg: to show "3.2MB written"
+// while a large PDF is rasterized. fn is called from whichever goroutine is
+// copying the backend's output, so it should be quick and safe to call
+// concurrently with the rest of the program. If a backend fails and what it
+// wrote is thrown away, fn is called with 0 before the next backend starts.
+// Other functions ignore it
+func WithProgress(fn func(written int64)) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// WithInputFormat skips detecting the format of the input and reads it as
+// format instead, passing it to ImageMagick as a format:- prefix. This is for
+// inputs that can't be detected, such as TGAs, or raw pixel data (rgb, rgba,
+// bgr, bgra, gray, graya, cmyk or cmyka, 8 bits per channel), whose size must
+// also be given with WithInputSize. Raw input requires ImageMagick
+func WithInputFormat(format string) Option {
+	return func(o *options) {
+		format = strings.ToLower(format)
+		if f, ok := extFormats[format]; ok { format = f }
+
+		if !contains(rawFormats, format) && !contains(magickInFormats, format) && !contains(goFormats, format) {
+			o.fail(errors.New("unknown input format \"" + format + "\""))
+			return
+		}
+
+		o.inputFormat = format
+	}
+}
+
+// WithKnownFormat is for when the format of the input is already known, such
+// as from having been stored alongside it. Detection is skipped entirely and
+// format is used to pick a backend, which saves the work and avoids the rare
+// image detection gets wrong. Unlike WithInputFormat, raw pixel data isn't
+// accepted, only formats that could have been detected
+func WithKnownFormat(format string) Option {
+	return func(o *options) {
+		format = strings.ToLower(format)
+		if f, ok := extFormats[format]; ok { format = f }
+
+		if contains(rawFormats, format) {
+			o.fail(errors.New("raw input formats must be given with WithInputFormat"))
+			return
+		}
+
+		WithInputFormat(format)(o)
+	}
+}
+
+// WithStrictFormat makes a format given with WithKnownFormat (or
+// WithInputFormat) be checked against the one detected, failing with
+// ErrFormatMismatch if they differ rather than trusting it. This catches
+// mislabeled files, such as a PNG named .svg, early on. Formats that can't be
+// detected, such as TGA and raw pixels, are still taken at their word
+func WithStrictFormat() Option {
+	return func(o *options) {
+		o.strictFormat = true
+	}
+}
+
+// WithInputSize gives the dimensions of raw pixel input, see WithInputFormat
+func WithInputSize(w int, h int) Option {
+	return func(o *options) {
+		if w < 1 || h < 1 {
+			o.fail(errors.New("input size must be above 0"))
+			return
+		}
+
+		o.inputW, o.inputH = w, h
+	}
+}
+
+// WithComment stores comment in the output's metadata, eg: where the image
+// came from or when it was generated. It's written exactly as given, as a
+// single argument with ImageMagick's escapes (% and @file) escaped. In Go,
+// PNGs get a Comment text chunk and JPEGs a COM segment. Formats without a
+// place for comments ignore it
+func WithComment(comment string) Option {
+	return func(o *options) {
+		if strings.ContainsRune(comment, 0) {
+			o.fail(errors.New("comment can't contain NUL characters"))
+			return
+		}
+
+		o.comment = comment
+	}
+}
+
+// WithDefaultSVGSize sets the size of SVGs that specify neither a width and
+// height nor a viewBox, which otherwise default to 512x512. Their intended
+// size is anyone's guess, but it's better to render them at some size than to
+// fail
+func WithDefaultSVGSize(w int, h int) Option {
+	return func(o *options) {
+		if w < 1 || h < 1 {
+			o.fail(errors.New("default SVG size must be above 0"))
+			return
+		}
+
+		o.svgW, o.svgH = w, h
+	}
+}
+
+// WithPreprocess runs fn on the input before anything else is done with it,
+// for custom transformations such as remapping the colors of an SVG. The
+// reader fn returns is used as the input instead. It runs before the format
+// is detected, so it's free to change the format. If given more than once,
+// they're chained in order. As the input has been handed to fn, it can't be
+// returned to the caller if the conversion fails
+func WithPreprocess(fn func(io.Reader) (io.Reader, error)) Option {
+	return func(o *options) {
+		if fn != nil {
+			o.preprocess = append(o.preprocess, fn)
+		}
+	}
+}
+
+// WithSquarePad pads the resized image to a square, centered on a background
+// of bg, an ImageMagick color such as "none" (transparent, also used if bg is
+// empty) or "#ffffff". The side of the square is the larger of the requested
+// width and height, so ConvertWithAspect(r, 256, "png", WithSquarePad(""))
+// always gives a 256x256 icon. Requires ImageMagick
+func WithSquarePad(bg string) Option {
+	return func(o *options) {
+		if bg == "" { bg = "none" }
+
+		if !magickColor.MatchString(bg) {
+			o.fail(errors.New("invalid background color \"" + bg + "\""))
+			return
+		}
+
+		o.squarePad = true
+		o.squareBg = bg
+	}
+}
+
+// WithDepth sets the bits per channel of the output, such as 16 for high bit
+// depth PNGs and TIFFs. Only formats able to store that depth are accepted,
+// see depthFormats. Requires ImageMagick
+func WithDepth(bits int) Option {
+	return func(o *options) {
+		if bits != 8 && bits != 16 && bits != 32 {
+			o.fail(errors.New("depth must be 8, 16 or 32 bits"))
+			return
+		}
+
+		o.depth = bits
+	}
+}
+
+// WithNormalize stretches the levels of the image so its darkest 2% becomes
+// black and its lightest 1% becomes white, which makes scans and underexposed
+// photos much easier to make out in thumbnails. It's done before resizing,
+// with ImageMagick's -normalize or in Go, where the same levels are used for
+// every channel
+func WithNormalize() Option {
+	return WithContrastStretch(2, 1)
+}
+
+// WithAutoLevel is like WithNormalize, but stretches the levels so only the
+// darkest and lightest values become black and white, leaving nothing
+// clipped (ImageMagick's -auto-level)
+func WithAutoLevel() Option {
+	return WithContrastStretch(0, 0)
+}
+
+// WithContrastStretch is like WithNormalize, but with the percent of the
+// darkest values made black and of the lightest made white given explicitly
+// (ImageMagick's -contrast-stretch)
+func WithContrastStretch(black float64, white float64) Option {
+	return func(o *options) {
+		if black < 0 || white < 0 || black+white >= 100 {
+			o.fail(errors.New("contrast stretch percents can't be negative and must add up to below 100"))
+			return
+		}
+
+		o.stretch, o.stretchBlack, o.stretchWhite = true, black, white
+	}
+}
+
+// WithRetries runs a backend that fails up to n more times before falling
+// back to the next one, waiting backoff before the first retry and twice as
+// long before each one after that. Some programs (Inkscape especially) fail
+// now and then on headless servers for reasons that have nothing to do with
+// the image, such as racing to start a display. Failures that would only
+// happen again, like ImageMagick's policy refusing a format, aren't retried.
+// Waiting is cut short if the context of ConvertContext is done
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(o *options) {
+		if n < 0 || backoff < 0 {
+			o.fail(errors.New("retries and backoff can't be negative"))
+			return
+		}
+
+		o.retries, o.retryBackoff = n, backoff
+	}
+}
+
+// WithBackgroundPattern draws a pattern behind the image, showing through
+// wherever it's transparent, such as the padding of WithSquarePad or
+// ResizePad. spec is either "checkerboard", the gray squares commonly used to
+// show transparency, or "gradient:<top>-<bottom>", a vertical gradient
+// between two ImageMagick colors, eg: "gradient:white-#336699". Requires
+// ImageMagick
+func WithBackgroundPattern(spec string) Option {
+	return func(o *options) {
+		if spec != "checkerboard" && !isGradient(spec) {
+			o.fail(errors.New("invalid background pattern \"" + spec + "\""))
+			return
+		}
+
+		o.bgPattern = spec
+	}
+}
+
+// isGradient checks that spec is a gradient between two colors, as taken by
+// WithBackgroundPattern
+func isGradient(spec string) bool {
+	if !strings.HasPrefix(spec, "gradient:") { return false }
+
+	colors := strings.Split(strings.TrimPrefix(spec, "gradient:"), "-")
+
+	return len(colors) == 2 && magickColor.MatchString(colors[0]) && magickColor.MatchString(colors[1])
+}
+
+// WithMaxInputBytes fails with ErrInputTooLarge as soon as more than n bytes
+// have been read from an input, before any backend is started, so untrusted
+// callers can't exhaust memory or disk with endless input. Functions taking
+// several inputs apply it to each one. By default there's no limit
+func WithMaxInputBytes(n int64) Option {
+	return func(o *options) {
+		if n < 1 {
+			o.fail(errors.New("max input size must be above 0"))
+			return
+		}
+
+		o.maxInput = n
+	}
+}
+
+// WithColors limits the palette of the output to n colors (2 to 256), for
+// formats that use one: png8 (palette PNG, which is often a fraction of the
+// size of a regular PNG for flat images), gif and xpm. Using it with any other
+// format is an error. Requires ImageMagick
+func WithColors(n int) Option {
+	return func(o *options) {
+		if n < 2 || n > 256 {
+			o.fail(errors.New("number of colors must be between 2 and 256"))
+			return
+		}
+
+		o.colors = n
+	}
+}
+
+// WithDither sets how colors are dithered when they're reduced to fit a
+// palette, for the formats WithColors can be used with. FloydSteinberg suits
+// gradients and photos, while None avoids speckling flat colors, such as in
+// rendered icons. Riemersma is also accepted (in any case). ImageMagick's
+// default is used if it isn't given, which is currently FloydSteinberg.
+// Requires ImageMagick
+func WithDither(method string) Option {
+	return func(o *options) {
+		for _, m := range ditherMethods {
+			if strings.EqualFold(m, method) {
+				o.dither = m
+				return
+			}
+		}
+
+		o.fail(errors.New("unknown dither method \"" + method + "\""))
+	}
+}
+
+// WithFilter sets the filter ImageMagick resamples images with when resizing
+// them, such as Lanczos (its usual choice for shrinking), Mitchell or Catrom.
+// This includes scaling SVGs down from the high density they're rendered at,
+// where a sharper filter (eg: LanczosSharp or Catrom) keeps the thin lines of
+// icons crisper, so SVGs are rendered with ImageMagick rather than
+// rsvg-convert or Inkscape when it's set. Names are accepted in any case, see
+// resizeFilters. Conversions it applies to require ImageMagick
+func WithFilter(name string) Option {
+	return func(o *options) {
+		for _, f := range resizeFilters {
+			if strings.EqualFold(f, name) {
+				o.filter = f
+				return
+			}
+		}
+
+		o.fail(errors.New("unknown resize filter \"" + name + "\""))
+	}
+}
+
+// WithLinearResize resizes images in linear light rather than straight from
+// their sRGB values, which otherwise darkens fine detail (eg: leaves, text or
+// hair) when it's scaled down, giving noticeably better thumbnails of
+// detailed photos. The conversions to linear RGB and back go over every pixel
+// of the full size image twice more, which can take as long as resizing it,
+// so it's off by default. It does nothing at the native resolution. Requires
+// ImageMagick
+func WithLinearResize() Option {
+	return func(o *options) {
+		o.linearResize = true
+	}
+}
+
+// WithLayers runs one of ImageMagick's layer methods over the frames of an
+// animation, for tuning the size of animated GIF and WebP output. Coalesce
+// and Dispose turn the frames into whole images, and are done before
+// resizing. The others work on whole frames, so the frames are coalesced
+// first, and are done after resizing and reducing colors, as resizing frames
+// that have already been optimized mangles them. Optimize is the usual choice
+// for making an animation smaller, while RemoveDups drops frames identical to
+// the one before. "deconstruct" is taken as CompareAny, which it's the same as.
+// Names are accepted in any case, see layerMethods. Using it with output that
+// isn't animated is an error. Requires ImageMagick
+func WithLayers(method string) Option {
+	return func(o *options) {
+		if strings.EqualFold(method, "deconstruct") { method = "CompareAny" }
+
+		for _, m := range layerMethods {
+			if strings.EqualFold(m, method) {
+				o.layers = m
+				return
+			}
+		}
+
+		o.fail(errors.New("unknown layer method \"" + method + "\""))
+	}
+}
+
+// WithErrorSummary makes errors from backends a short summary of the failure
+// (eg: "converting svg to png failed") instead of everything the backend wrote
+// to stderr, which can be long and give away paths on the system. This is for
+// errors that end up in front of users. The full detail is still available by
+// getting the *ConvertError with errors.As
+func WithErrorSummary() Option {
+	return func(o *options) {
+		o.errorSummary = true
+	}
+}
+
+// WithStreamingInput makes Convert and ConvertStream pass the input straight
+// through to the backend as it's read, rather than reading all of it first,
+// so a conversion can get started while a large input is still arriving (eg:
+// over a socket). Only enough to detect the format is read up front. As the
+// input can then only be read once, there's no falling back to another
+// backend after the first has started reading it, and Convert can't hand
+// back the original image on failure. Inputs that have to be read more than
+// once anyway (SVG, ICNS, GIF to GIF, etc) are still buffered. TIFF and other
+// formats ImageMagick would read into memory whole are written to a temporary
+// file as they arrive instead (past 1MiB, or the size given with
+// WithSpillThreshold), as it reads files a bit at a time. Along with
+// ConvertStream, which writes the output as it's made, and WithMemoryLimit,
+// which has ImageMagick keep pixels on disk past the limit, this converts
+// huge images (eg: scans of hundreds of megapixels) in bounded memory
+func WithStreamingInput() Option {
+	return func(o *options) {
+		o.streamInput = true
+	}
+}
+
+// WithCloseFile makes ConvertToFile close the file it's given once it's done,
+// whether it succeeds or not. By default the file is left open for the caller
+func WithCloseFile() Option {
+	return func(o *options) {
+		o.closeFile = true
+	}
+}
+
+// WithQuality sets the quality (1 to 100) lossy formats are written at, where
+// 100 is the best. It's passed to ImageMagick as -quality (which for PNGs
+// sets the compression instead) and to cjxl and cwebp as -q, and is used by
+// the built-in JPEG encoder
+func WithQuality(q int) Option {
+	return func(o *options) {
+		if q < 1 || q > 100 {
+			o.fail(errors.New("quality must be between 1 and 100"))
+			return
+		}
+
+		o.quality = q
+	}
+}
+
+// WithEffort sets how hard JPEG XL encoding tries (1 to 9), trading speed for
+// smaller files. Other formats ignore it
+func WithEffort(n int) Option {
+	return func(o *options) {
+		if n < 1 || n > 9 {
+			o.fail(errors.New("effort must be between 1 and 9"))
+			return
+		}
+
+		o.effort = n
+	}
+}
+
+// WithWebPMethod sets the compression method of WebP output, from 0 (fastest)
+// to 6 (smallest files). It's passed to cwebp as -m and to ImageMagick as
+// webp:method. Other formats ignore it
+func WithWebPMethod(m int) Option {
+	return func(o *options) {
+		if m < 0 || m > 6 {
+			o.fail(errors.New("WebP method must be between 0 and 6"))
+			return
+		}
+
+		o.webpMethod = m
+		o.hasWebpMethod = true
+	}
+}
+
+// WithRotate rotates the image clockwise by degrees, which must be a multiple
+// of 90 (negative for counterclockwise). JPEG to JPEG conversions that do
+// nothing else are rotated losslessly with jpegtran if it's installed, and
+// anything else requires ImageMagick
+func WithRotate(degrees int) Option {
+	return func(o *options) {
+		if degrees%90 != 0 {
+			o.fail(errors.New("rotation must be a multiple of 90 degrees"))
+			return
+		}
+
+		o.rotate = (degrees%360 + 360) % 360
+	}
+}
+
+// WithOptimizeCoding makes JPEG output use Huffman tables optimized for the
+// image rather than the standard ones, which makes it a little smaller at the
+// cost of some encoding time. It's passed to ImageMagick as
+// jpeg:optimize-coding and to jpegtran as -optimize. Other formats ignore it
+func WithOptimizeCoding() Option {
+	return func(o *options) {
+		o.optimizeCoding = true
+	}
+}
+
+// WithRestartInterval puts a restart marker in JPEG output every n rows of
+// MCUs (blocks), which some embedded and streaming decoders need to recover
+// from corrupt data. It's passed to ImageMagick as jpeg:restart-interval and
+// to jpegtran as -restart. Other formats ignore it
+func WithRestartInterval(n int) Option {
+	return func(o *options) {
+		if n < 1 {
+			o.fail(errors.New("restart interval must be above 0"))
+			return
+		}
+
+		o.restartInterval = n
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConvertPages converts every page or frame of a multi-image input (PDF, TIFF,
+// ICO, GIF, etc) into its own file. destPattern must contain a single %d,
+// which is replaced by the page number starting at 0 (eg: "page-%d.png").
+// The paths of the created files are returned in page order, so the page
+// count is just their length. Single-page inputs produce a single file,
+// still numbered 0. This requires ImageMagick
+func ConvertPages(data io.Reader, destPattern string, w int, h int, format string, opts ...Option) ([]string, error) {
+	if strings.Count(destPattern, "%") != 1 || !strings.Contains(destPattern, "%d") {
+		return nil, errors.New("destPattern must contain exactly one %d placeholder")
+	}
+
+	if err := checkRes(w, h); err != nil { return nil, err }
+
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	format, err = o.outputFormat(format, destPattern)
+	if err != nil { return nil, err }
+
+	mimetype, src, err := readInput(data, o, "pdf")
+	defer src.remove()
+	if err != nil { return nil, err }
+
+	if !contains(magickInFormats, mimetype) || !contains(magickOutFormats, format) {
+		return nil, errors.New("ImageMagick can't convert "+mimetype+" pages to "+format)
+	}
+
+	cmd, sub, err := findMagick("convert")
+	if err != nil {
+		return nil, errors.New("ConvertPages requires ImageMagick to be installed")
+	}
+
+	j := &job{
+		formatIn:  mimetype,
+		formatOut: format,
+		w:         w,
+		h:         h,
+		input:     src.input(),
+		opts:      o,
+	}
+
+	// The pages are written somewhere of their own first, so that files left
+	// over from before that happen to follow destPattern aren't mistaken for
+	// pages. It's next to the destination so they can be renamed into place
+	dir, err := os.MkdirTemp(filepath.Dir(destPattern), ".imgconv-*")
+	if err != nil { return nil, err }
+	defer os.RemoveAll(dir)
+
+	pattern := filepath.Join(dir, "page-%d."+format)
+
+	args := magickArgs(j, format+":"+pattern)
+	if _, err := run(cmd, append(sub, args...), src, o); err != nil { return nil, err }
+
+	written := findPages(pattern)
+
+	// Older versions of ImageMagick don't substitute the page number when the
+	// input only has a single page
+	if len(written) == 0 {
+		if _, err := os.Stat(pattern); err == nil {
+			written = []string{ pattern }
+		}
+	}
+
+	if len(written) == 0 {
+		return nil, errors.New("convert: no pages were written")
+	}
+
+	var pages []string
+	for i, page := range written {
+		dest := fmt.Sprintf(destPattern, i)
+		if err := os.Rename(page, dest); err != nil {
+			removePages(pages)
+			return nil, err
+		}
+
+		pages = append(pages, dest)
+	}
+
+	return pages, nil
+}
+
+// findPages returns the files following destPattern, counting up from 0 until
+// one doesn't exist
+func findPages(destPattern string) []string {
+	var pages []string
+
+	for i := 0; ; i++ {
+		page := fmt.Sprintf(destPattern, i)
+		if _, err := os.Stat(page); err != nil { break }
+
+		pages = append(pages, page)
+	}
+
+	return pages
+}
+
+// removePages cleans up the pages already moved into place by a failed
+// ConvertPages
+func removePages(pages []string) {
+	for _, page := range pages {
+		os.Remove(page)
+	}
+}
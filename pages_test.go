@@ -0,0 +1,60 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// pagesScript writes two pages following the pattern convert is given last
+const pagesScript = `for arg; do out=$arg; done
+out=${out#*:}
+printf 0 > "$(printf "$out" 0)"
+printf 1 > "$(printf "$out" 1)"`
+
+func TestConvertPagesLeftovers(t *testing.T) {
+	fakePrograms(t, map[string]string{ "convert": pagesScript })
+
+	dir := t.TempDir()
+	leftover := filepath.Join(dir, "page-2.png")
+	if err := os.WriteFile(leftover, []byte("old"), 0644); err != nil { t.Fatal(err) }
+
+	pattern := filepath.Join(dir, "page-%d.png")
+	pages, err := ConvertPages(bytes.NewReader(testPNG(8, 8)), pattern, -1, -1, "png")
+	if err != nil { t.Fatal(err) }
+
+	want := []string{ filepath.Join(dir, "page-0.png"), filepath.Join(dir, "page-1.png") }
+	if !reflect.DeepEqual(pages, want) { t.Errorf("got pages %v, want %v", pages, want) }
+
+	for i, page := range want {
+		b, err := os.ReadFile(page)
+		if err != nil { t.Fatal(err) }
+		if string(b) != string(rune('0'+i)) { t.Errorf("%s holds %q, want page %d", page, b, i) }
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 { t.Errorf("%d files left in the destination, want the 2 pages and the leftover", len(entries)) }
+}
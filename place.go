@@ -0,0 +1,91 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// Shape of the colors accepted by ImageMagick, eg: "none", "white", "#ff000080"
+// or "rgba(0,0,0,0.5)"
+var magickColor = regexp.MustCompile(`^[A-Za-z#][A-Za-z0-9#(),.% ]*$`)
+
+// PlaceOn draws img at offset x, y of a canvasW x canvasH canvas filled with
+// bg, an ImageMagick color such as "none" (transparent), "white" or
+// "#336699". This is a building block for sprite sheets and other layouts
+// that don't fit a grid. The offset must be within the canvas, but the image
+// itself may run off its edges, in which case it's cut off. This requires
+// ImageMagick
+func PlaceOn(canvasW int, canvasH int, bg string, img io.Reader, x int, y int, format string, opts ...Option) (io.Reader, error) {
+	if canvasW < 1 || canvasH < 1 {
+		return nil, errors.New("canvas size must be above 0")
+	}
+
+	if x < 0 || y < 0 || x >= canvasW || y >= canvasH {
+		return nil, errors.New("offset " + strconv.Itoa(x) + "," + strconv.Itoa(y) + " is outside of the canvas")
+	}
+
+	if !magickColor.MatchString(bg) {
+		return nil, errors.New("invalid background color \"" + bg + "\"")
+	}
+
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	format, err = o.outputFormat(format, "")
+	if err != nil { return nil, err }
+
+	if !contains(magickOutFormats, format) {
+		return nil, errors.New("ImageMagick can't write " + format)
+	}
+
+	mimetype, src, err := readInput(img, o)
+	defer src.remove()
+	if err != nil { return nil, err }
+
+	if !contains(magickInFormats, mimetype) {
+		return nil, errors.New("ImageMagick can't read " + mimetype)
+	}
+
+	cmd, sub, err := findMagick("convert")
+	if err != nil {
+		return nil, errors.New("PlaceOn requires ImageMagick to be installed")
+	}
+
+	args := append(magickLimits(o),
+		"-size", strconv.Itoa(canvasW) + "x" + strconv.Itoa(canvasH),
+		"xc:" + bg,
+		src.input(),
+		"-geometry", "+" + strconv.Itoa(x) + "+" + strconv.Itoa(y),
+		"-composite",
+		format + ":-",
+	)
+
+	out, err := run(cmd, append(sub, args...), src, o)
+	if err != nil { return nil, err }
+
+	return bytes.NewReader(out), nil
+}
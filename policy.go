@@ -0,0 +1,51 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotAuthorized is returned when ImageMagick refuses to read or write a
+// format because its security policy disables it. Many distributions ship a
+// policy.xml that does so for SVG, PDF and PostScript
+var ErrNotAuthorized = errors.New("format disabled by ImageMagick's security policy")
+
+// isPolicyError checks whether ImageMagick failed because of its security
+// policy, going by what it wrote to stderr
+func isPolicyError(stderr string) bool {
+	msg := strings.ToLower(stderr)
+
+	return strings.Contains(msg, "not authorized") || strings.Contains(msg, "security policy")
+}
+
+// policyError describes the policy getting in the way of j, with what can be
+// done about it, as ImageMagick's own message doesn't make that obvious
+func policyError(j *job, name string, stderr string) error {
+	return fmt.Errorf("%w: %s refused to convert %s to %s. Allow both coders in its "+
+		"policy.xml (see `convert -list policy` for where it is) or install "+
+		"another backend able to do the conversion. It said: %s",
+		ErrNotAuthorized, name, j.formatIn, j.formatOut, strings.TrimSpace(stderr))
+}
@@ -0,0 +1,90 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// ConvertRaw renders an image to raw pixel data, for when the pixels are
+// wanted directly (eg: to upload as a texture) rather than an encoded file.
+// The pixels are 8-bit, non-premultiplied RGBA, row-major starting from the
+// top left, 4 bytes per pixel with no padding between rows, so pixel (x, y)
+// starts at (y*width + x) * 4. The actual dimensions of the output are
+// returned, as ImageMagick keeps the aspect ratio within w and h
+func ConvertRaw(data io.Reader, w int, h int, opts ...Option) ([]byte, int, int, error) {
+	if err := checkRes(w, h); err != nil { return nil, 0, 0, err }
+
+	o, err := getOptions(opts)
+	if err != nil { return nil, 0, 0, err }
+
+	mimetype, src, err := readInput(data, o, videoFormats...)
+	defer src.remove()
+	if err != nil { return nil, 0, 0, err }
+
+	var r io.Reader
+
+	// If no resizing is needed and Go can decode the input itself, there's no
+	// reason to start a backend
+	if w == -1 && h == -1 && contains([]string{ "png", "jpg", "gif" }, mimetype) {
+		r, err = src.reader()
+		defer closeReader(r)
+	} else {
+		r, err = convert(src, mimetype, w, h, "png", o)
+	}
+	if err != nil { return nil, 0, 0, err }
+
+	img, _, err := image.Decode(r)
+	if err != nil { return nil, 0, 0, err }
+
+	b := img.Bounds()
+	rgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+
+	return rgba.Pix, b.Dx(), b.Dy(), nil
+}
+
+// ConvertImage converts an image made in Go to format, for formats Go can't
+// write by itself. The image is encoded to a PNG, which loses nothing, and
+// handed to whichever backend can convert it to format. The image is kept at
+// its own size
+func ConvertImage(img image.Image, format string, opts ...Option) (io.Reader, error) {
+	if img == nil { return nil, errors.New("no image given") }
+
+	o, err := getOptions(opts)
+	if err != nil { return nil, err }
+
+	// The backend decodes it straight away, so there's no point spending time
+	// compressing it well
+	enc := png.Encoder{ CompressionLevel: png.BestSpeed }
+
+	var b bytes.Buffer
+	if err := enc.Encode(&b, img); err != nil { return nil, err }
+
+	return convert(&source{data: b.Bytes()}, "png", -1, -1, format, o)
+}
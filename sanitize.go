@@ -0,0 +1,293 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrUnsafeSVG is returned when rejecting an SVG with scripts or external
+// references, see WithRejectUnsafeSVG
+var ErrUnsafeSVG = errors.New("svg contains scripts or external references")
+
+// Elements that are removed from SVGs along with everything inside them, as
+// they can run scripts or embed arbitrary HTML
+var unsafeElements = []string{
+	"script", "foreignObject", "iframe", "embed", "object",
+}
+
+// Elements that animate another attribute, which are unsafe when they set a
+// link to somewhere outside the document
+var animationElements = []string{
+	"animate", "set", "animateMotion", "animateTransform", "animateColor",
+}
+
+// Attributes of animations holding the values they set
+var animationValueAttrs = []string{ "to", "from", "by", "values" }
+
+// Escapes text content without touching whitespace, unlike xml.EscapeText
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// SanitizeSVG removes everything from an SVG that could make a backend run a
+// script or fetch a file, which is a concern when rendering SVGs uploaded by
+// users. That is script and foreignObject elements, event handler attributes
+// (onload etc), links and url() references to anything outside the document
+// except for embedded raster images, animations setting such links or event
+// handlers, CSS @import rules (escaped or not), processing instructions such
+// as xml-stylesheet and the DOCTYPE, which is where XML entities would be
+// declared. Everything else is kept as written
+func SanitizeSVG(data io.Reader) (io.Reader, error) {
+	b, err := io.ReadAll(data)
+	if err != nil { return nil, err }
+
+	out, err := sanitizeSvg(b, false)
+	if err != nil { return nil, err }
+
+	return bytes.NewReader(out), nil
+}
+
+// sanitizeSvg returns b with everything unsafe removed, or if strict, an
+// error wrapping ErrUnsafeSVG describing the first unsafe thing found
+func sanitizeSvg(b []byte, strict bool) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+
+	// Undefined entities are left as text instead of failing, they'll be
+	// escaped on the way out so nothing expands them
+	d.Strict = false
+
+	var out bytes.Buffer
+
+	// How deep we are inside an element being removed, and whether the text
+	// being read is a stylesheet
+	skip    := 0
+	inStyle := false
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF { break }
+		if err != nil { return nil, err }
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 {
+				skip++
+				continue
+			}
+
+			if isUnsafeElement(t.Name.Local) || isUnsafeAnimation(t) {
+				if strict { return nil, unsafeSvg("<" + t.Name.Local + "> element") }
+				skip++
+				continue
+			}
+
+			attrs := t.Attr[:0]
+			for _, attr := range t.Attr {
+				if isUnsafeAttr(attr) {
+					if strict { return nil, unsafeSvg(qualifiedName(attr.Name) + " attribute") }
+					continue
+				}
+
+				attrs = append(attrs, attr)
+			}
+			t.Attr = attrs
+
+			inStyle = t.Name.Local == "style"
+			writeStartTag(&out, t, false)
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			inStyle = false
+			out.WriteString("</" + qualifiedName(t.Name) + ">")
+		case xml.CharData:
+			if skip > 0 { continue }
+
+			if inStyle && hasExternalRef(string(t)) {
+				if strict { return nil, unsafeSvg("external reference in stylesheet") }
+				continue
+			}
+
+			textEscaper.WriteString(&out, string(t))
+		case xml.Comment:
+			if skip > 0 { continue }
+
+			out.WriteString("<!--")
+			out.Write(t)
+			out.WriteString("-->")
+		case xml.ProcInst:
+			// Only the XML declaration is kept, the others can pull in
+			// external stylesheets
+			if t.Target != "xml" {
+				if strict { return nil, unsafeSvg("<?" + t.Target + "?> processing instruction") }
+				continue
+			}
+
+			out.WriteString("<?xml ")
+			out.Write(t.Inst)
+			out.WriteString("?>")
+		case xml.Directive:
+			if strict { return nil, unsafeSvg("DOCTYPE") }
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+func unsafeSvg(what string) error {
+	return fmt.Errorf("%w: %s", ErrUnsafeSVG, what)
+}
+
+func isUnsafeElement(name string) bool {
+	return containsFold(unsafeElements, name)
+}
+
+// isUnsafeAnimation checks whether t animates an event handler, or a link to
+// anything outside of the document. The values it sets are checked rather
+// than the attributes themselves, which aren't links
+func isUnsafeAnimation(t xml.StartElement) bool {
+	if !containsFold(animationElements, t.Name.Local) { return false }
+
+	var target string
+	for _, attr := range t.Attr {
+		if strings.EqualFold(attr.Name.Local, "attributeName") {
+			target = strings.ToLower(strings.TrimSpace(attr.Value))
+		}
+	}
+
+	// The target can be given with a namespace prefix, as in xlink:href
+	if i := strings.LastIndexByte(target, ':'); i != -1 { target = target[i+1:] }
+
+	if strings.HasPrefix(target, "on") { return true }
+	if target != "href" { return false }
+
+	for _, attr := range t.Attr {
+		if !containsFold(animationValueAttrs, attr.Name.Local) { continue }
+
+		for _, value := range strings.Split(attr.Value, ";") {
+			if !isLocalRef(value) { return true }
+		}
+	}
+
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) { return true }
+	}
+
+	return false
+}
+
+// isUnsafeAttr checks whether attr is an event handler or refers to anything
+// outside of the document
+func isUnsafeAttr(attr xml.Attr) bool {
+	name := strings.ToLower(attr.Name.Local)
+	if strings.HasPrefix(name, "on") { return true }
+
+	// Covers both href and xlink:href
+	if name == "href" && !isLocalRef(attr.Value) { return true }
+
+	// Presentation attributes (fill, filter, etc) as well as style can point
+	// elsewhere with url()
+	return hasExternalRef(attr.Value)
+}
+
+// hasExternalRef checks CSS for @import rules or url() references to anything
+// outside of the document. Escapes are undone first, so they can't be used to
+// spell either differently
+func hasExternalRef(css string) bool {
+	lower := strings.ToLower(cssUnescape(css))
+	if strings.Contains(lower, "@import") { return true }
+
+	for {
+		i := strings.Index(lower, "url(")
+		if i == -1 { return false }
+		lower = lower[i+4:]
+
+		end := strings.IndexByte(lower, ')')
+		if end == -1 { end = len(lower) }
+
+		ref := strings.Trim(lower[:end], " \t\r\n'\"")
+		if !isLocalRef(ref) { return true }
+	}
+}
+
+// isLocalRef checks whether a link points within the document itself or is
+// an embedded raster image. Embedded SVGs are excluded as they could have
+// external references of their own
+func isLocalRef(ref string) bool {
+	ref = strings.ToLower(strings.TrimSpace(ref))
+
+	if ref == "" || strings.HasPrefix(ref, "#") { return true }
+
+	return strings.HasPrefix(ref, "data:image/") && !strings.HasPrefix(ref, "data:image/svg")
+}
+
+// cssUnescape undoes CSS escapes: a backslash followed by up to 6 hex digits
+// and an optional space is that code point, a backslash before a newline is
+// nothing at all, and before anything else is the character itself
+func cssUnescape(css string) string {
+	if !strings.Contains(css, `\`) { return css }
+
+	var b strings.Builder
+	for i := 0; i < len(css); i++ {
+		if css[i] != '\\' || i == len(css)-1 {
+			b.WriteByte(css[i])
+			continue
+		}
+
+		i++
+
+		n := 0
+		for n < 6 && i+n < len(css) && isHexDigit(css[i+n]) { n++ }
+
+		if n == 0 {
+			if css[i] != '\n' { b.WriteByte(css[i]) }
+			continue
+		}
+
+		r, _ := strconv.ParseUint(css[i:i+n], 16, 32)
+		if r == 0 || r > unicode.MaxRune { r = unicode.ReplacementChar }
+		b.WriteRune(rune(r))
+
+		i += n - 1
+
+		// A single space ends the escape and isn't part of the text
+		if i+1 < len(css) && strings.IndexByte(" \t\n\r\f", css[i+1]) != -1 { i++ }
+	}
+
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,90 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const svgOpen = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">`
+
+func TestSanitizeSVGUnsafe(t *testing.T) {
+	tests := map[string]string{
+		"script":          `<script>alert(1)</script>`,
+		"event handler":   `<rect onclick="alert(1)"/>`,
+		"external href":   `<image href="https://example.com/x.png"/>`,
+		"javascript href": `<a xlink:href="javascript:alert(1)"><rect/></a>`,
+		"url":             `<rect fill="url(https://example.com/x.svg#p)"/>`,
+		"import":          `<style>@import "https://example.com/x.css";</style>`,
+
+		"set href":          `<a href="#"><set attributeName="href" to="javascript:alert(1)"/><rect/></a>`,
+		"animate href":      `<a><animate attributeName="xlink:href" values="#a;javascript:alert(1)"/></a>`,
+		"animate from":      `<a><animate attributeName="HREF" from="https://example.com" to="#a"/></a>`,
+		"animateMotion":     `<a><animateMotion attributeName="href" by="https://example.com"/></a>`,
+		"animate handler":   `<rect><set attributeName="onclick" to="alert(1)"/></rect>`,
+
+		"escaped import":    `<style>@\69mport "https://example.com/x.css";</style>`,
+		"escaped url":       `<rect style="fill: u\72l(https://example.com/x.svg#p)"/>`,
+		"escaped url space": `<rect style="fill: \75 rl(https://example.com/x.svg#p)"/>`,
+		"escaped letter":    `<style>rect { fill: \url(https://example.com/x.svg#p) }</style>`,
+		"escaped newline":   "<style>@im\\\nport \"https://example.com/x.css\";</style>",
+	}
+
+	for name, payload := range tests {
+		svg := svgOpen + payload + `</svg>`
+
+		if _, err := sanitizeSvg([]byte(svg), true); !errors.Is(err, ErrUnsafeSVG) {
+			t.Errorf("%s: got %v, want it rejected", name, err)
+		}
+
+		out, err := sanitizeSvg([]byte(svg), false)
+		if err != nil { t.Errorf("%s: %v", name, err); continue }
+
+		if _, err := sanitizeSvg(out, true); err != nil {
+			t.Errorf("%s: still unsafe after sanitizing: %s", name, out)
+		}
+	}
+}
+
+func TestSanitizeSVGSafe(t *testing.T) {
+	tests := map[string]string{
+		"local href":    `<use href="#a"></use>`,
+		"local url":     `<rect fill="url(#grad)"></rect>`,
+		"embedded png":  `<image href="data:image/png;base64,AAAA"></image>`,
+		"animation":     `<rect><animate attributeName="x" from="0" to="10" dur="1s"></animate></rect>`,
+		"local set":     `<a><set attributeName="href" to="#b"></set></a>`,
+		"escaped class": `<style>.a\:b { fill: red }</style>`,
+	}
+
+	for name, payload := range tests {
+		svg := svgOpen + payload + `</svg>`
+
+		out, err := sanitizeSvg([]byte(svg), true)
+		if err != nil { t.Errorf("%s: %v", name, err); continue }
+
+		if !strings.Contains(string(out), payload) {
+			t.Errorf("%s: got %s, want it kept as written", name, out)
+		}
+	}
+}
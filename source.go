@@ -0,0 +1,306 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrInputTooLarge is returned when the input is larger than allowed by
+// WithMaxInputBytes
+var ErrInputTooLarge = errors.New("input exceeds maximum size")
+
+// ErrFormatMismatch is returned when the format given with WithKnownFormat
+// isn't the one detected, with WithStrictFormat
+var ErrFormatMismatch = errors.New("input format doesn't match the one given")
+
+// How much of the input is read in order to detect its format, this is the
+// same as the default limit used by the mimetype library
+const sniffLen = 3072
+
+// Streamed inputs in seekFormats larger than this are written to disk as they
+// arrive, unless WithSpillThreshold gives another size
+const seekSpillThreshold = 1 << 20
+
+// Formats ImageMagick has to seek around in to decode, which it reads into
+// memory whole when they're piped in. It reads files a bit at a time, which
+// keeps memory down for huge images such as scans
+var seekFormats = []string{ "tiff", "psd", "xcf" }
+
+// source holds the entire input of a conversion so that it can be read more
+// than once. Small inputs stay in memory, but those larger than the spill
+// threshold are written to a temporary file instead
+type source struct {
+	data []byte
+	path string // Path of the temporary file if the input was spilled
+
+	// The rest of the input when it's passed straight through to the backend
+	// instead, see WithStreamingInput. It can only be read once
+	stream io.Reader
+	read   bool   // Whether stream has been read
+	head   []byte // What was read of a streamed input to detect its format
+}
+
+// readInput buffers data and detects its format. Even if the format can't be
+// detected the source is still returned so the original image can be given
+// back to the caller. Non-image formats in allowed are accepted as input
+func readInput(data io.Reader, o *options, allowed ...string) (string, *source, error) {
+	return readSource(data, o, false, allowed...)
+}
+
+// readSource is readInput, but if stream is set the input is only read as far
+// as needed to detect its format, leaving the rest to be passed straight
+// through to the backend. Inputs that have to be looked at before they're
+// converted are still buffered
+func readSource(data io.Reader, o *options, stream bool, allowed ...string) (string, *source, error) {
+	data = limitInput(data, o.maxInput)
+
+	// Preprocessors go first, so they're free to change the format. What they
+	// return is held to the same limit
+	for _, fn := range o.preprocess {
+		r, err := fn(data)
+		if err == nil && r == nil { err = errors.New("preprocessor returned no input") }
+		if err != nil { return "", &source{}, err }
+
+		data = limitInput(r, o.maxInput)
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(data, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", &source{data: head[:n]}, err
+	}
+	head = head[:n]
+
+	// An explicit input format is taken at its word, without trying to
+	// detect anything
+	mimetype, typeErr := o.inputFormat, error(nil)
+	if mimetype == "" {
+		mimetype, typeErr = getType(bytes.NewReader(head), allowed...)
+	}
+
+	// Formats detection can't make out (such as TGA and raw pixels) are
+	// still taken at their word
+	if o.strictFormat && o.inputFormat != "" && !contains(rawFormats, o.inputFormat) {
+		detected, err := getType(bytes.NewReader(head), allowed...)
+		if err == nil && detected != o.inputFormat {
+			return "", &source{data: head}, fmt.Errorf("%w: given as %s, but it's %s",
+				ErrFormatMismatch, o.inputFormat, detected)
+		}
+	}
+
+	in := io.MultiReader(bytes.NewReader(head), data)
+
+	// Untrusted SVGs are checked as a whole before anything else gets to
+	// them, which means they're always read into memory
+	if mimetype == "svg" && (o.sanitizeSvg || o.rejectUnsafeSvg) {
+		b, err := io.ReadAll(in)
+		if err != nil { return "", &source{data: b}, err }
+
+		clean, err := sanitizeSvg(b, o.rejectUnsafeSvg)
+		if err != nil { return "", &source{data: b}, err }
+
+		in = bytes.NewReader(clean)
+	}
+
+	if stream && typeErr == nil && mimetype != "svg" && mimetype != "icns" && !o.selectFrame &&
+		!o.squarePad && !(o.skipIfMatches && !o.forceReencode) && jpegHeaderIn(mimetype, head) {
+		if !contains(seekFormats, mimetype) {
+			return mimetype, &source{stream: in, head: head}, nil
+		}
+
+		threshold := o.spillThreshold
+		if threshold <= 0 { threshold = seekSpillThreshold }
+
+		src, err := bufferInput(in, mimetype, threshold)
+		return mimetype, src, err
+	}
+
+	src, err := bufferInput(in, mimetype, o.spillThreshold)
+	if err != nil { return "", src, err }
+
+	// ICNS files hold the same icon at several sizes, of which only the
+	// largest is worth converting
+	if mimetype == "icns" && !o.wholeIcns {
+		mimetype, src, err = largestIcns(src)
+		if err != nil { return "", src, err }
+	}
+
+	return mimetype, src, typeErr
+}
+
+// bufferInput reads all of data into a source, spilling it to a temporary
+// file if it's larger than threshold bytes. ext is used as the extension of
+// the file, as some programs use it to figure out what they're reading
+func bufferInput(data io.Reader, ext string, threshold int64) (*source, error) {
+	if threshold <= 0 {
+		b, err := io.ReadAll(data)
+		return &source{data: b}, err
+	}
+
+	b, err := io.ReadAll(io.LimitReader(data, threshold+1))
+	if err != nil || int64(len(b)) <= threshold {
+		return &source{data: b}, err
+	}
+
+	pattern := "imgconv-*"
+	if ext != "" { pattern += "." + ext }
+
+	file, err := os.CreateTemp("", pattern)
+	if err != nil { return &source{data: b}, err }
+
+	_, err = file.Write(b)
+	if err == nil {
+		_, err = io.Copy(file, data)
+	}
+
+	file.Close()
+	if err != nil {
+		os.Remove(file.Name())
+		return &source{data: b}, err
+	}
+
+	return &source{path: file.Name()}, nil
+}
+
+// spill writes an input that's still in memory to a temporary file, for
+// backends that can't read it from stdin
+func (s *source) spill(ext string) error {
+	if s.path != "" { return nil }
+
+	pattern := "imgconv-*"
+	if ext != "" { pattern += "." + ext }
+
+	file, err := os.CreateTemp("", pattern)
+	if err != nil { return err }
+
+	_, err = file.Write(s.data)
+	file.Close()
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	s.data = nil
+	s.path = file.Name()
+
+	return nil
+}
+
+// fill buffers the rest of a streamed input, for conversions that turn out to
+// need to read it more than once
+func (s *source) fill(ext string, threshold int64) error {
+	if s.stream == nil { return nil }
+
+	b, err := bufferInput(s.stream, ext, threshold)
+	s.data, s.path, s.stream = b.data, b.path, nil
+
+	return err
+}
+
+// peek returns a reader of the input for looking at its header, which for a
+// streamed input is only what was read to detect its format
+func (s *source) peek() (io.Reader, error) {
+	if s.stream != nil || s.read { return bytes.NewReader(s.head), nil }
+
+	return s.reader()
+}
+
+// jpegHeaderIn checks that the header of a JPEG, which says whether it's
+// CMYK, is within head. It's preceded by metadata that can be large, in
+// which case the input is buffered. Other formats don't need checking
+func jpegHeaderIn(mimetype string, head []byte) bool {
+	if mimetype != "jpg" { return true }
+
+	_, _, err := jpegColor(bytes.NewReader(head))
+	return err == nil
+}
+
+// reader returns a new reader of the whole input. A streamed input can only
+// be read once
+func (s *source) reader() (io.Reader, error) {
+	if s.read {
+		return nil, errors.New("streamed input can only be read once")
+	}
+
+	if s.stream != nil {
+		r := s.stream
+		s.stream, s.read = nil, true
+
+		return r, nil
+	}
+
+	if s.path == "" {
+		return bytes.NewReader(s.data), nil
+	}
+
+	return os.Open(s.path)
+}
+
+// input returns what the backend should be given as its input file, "-"
+// meaning stdin
+func (s *source) input() string {
+	if s.path == "" { return "-" }
+
+	return s.path
+}
+
+// remove deletes the temporary file backing the source, if there is one
+func (s *source) remove() {
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+}
+
+// limitInput wraps r so that reading more than n bytes from it fails with
+// ErrInputTooLarge, unless n is 0
+func limitInput(r io.Reader, n int64) io.Reader {
+	if n <= 0 { return r }
+
+	return &limitedReader{ r: r, n: n }
+}
+
+// limitedReader is like io.LimitedReader, but fails instead of pretending the
+// input ended
+type limitedReader struct {
+	r io.Reader
+	n int64 // Bytes left before the limit is hit
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// Read one byte past the limit to tell whether there's more
+	if int64(len(p)) > l.n+1 { p = p[:l.n+1] }
+
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		l.n = -1
+		return 0, ErrInputTooLarge
+	}
+	l.n -= int64(n)
+
+	return n, err
+}
@@ -0,0 +1,144 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"io"
+	"os"
+)
+
+// ConvertStream does the same as Convert, but writes the converted image to
+// dst as the backend produces it rather than buffering it all first, which
+// keeps large outputs out of memory and allows for progress reporting with
+// WithProgress. Unlike Convert, if a backend fails after it's started
+// writing there's no falling back to another, as dst can't be taken back
+func ConvertStream(data io.Reader, dst io.Writer, w int, h int, format string, opts ...Option) error {
+	if err := checkRes(w, h); err != nil { return err }
+
+	o, err := getOptions(opts)
+	if err != nil { return err }
+
+	return convertStream(data, dst, nil, w, h, format, o)
+}
+
+// ConvertToFile does the same as ConvertStream, writing to an already open
+// file (eg: a memfd or one the caller has allocated) at its current offset.
+// If the file can be seeked, failing backends are fallen back from like with
+// Convert, and anything written by a failed conversion is truncated away.
+// The file is left open unless WithCloseFile is given
+func ConvertToFile(data io.Reader, f *os.File, w int, h int, format string, opts ...Option) error {
+	if err := checkRes(w, h); err != nil { return err }
+
+	o, err := getOptions(opts)
+	if err != nil { return err }
+
+	reset := fileReset(f)
+
+	err = convertStream(data, f, reset, w, h, format, o)
+	if err != nil && reset != nil { reset() }
+
+	if o.closeFile {
+		if cerr := f.Close(); err == nil { err = cerr }
+	}
+
+	return err
+}
+
+// fileReset returns a func truncating f back to its current offset, nil if it
+// can't be seeked
+func fileReset(f *os.File) func() {
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil { return nil }
+
+	return func() {
+		f.Truncate(start)
+		f.Seek(start, io.SeekStart)
+	}
+}
+
+// convertStream does the work of ConvertStream. reset empties dst so another
+// backend can be tried, nil if it can't be
+func convertStream(data io.Reader, dst io.Writer, reset func(), w int, h int, format string, o *options) error {
+	mimetype, src, err := readSource(data, o, o.streamInput, videoFormats...)
+	defer src.remove()
+	if err != nil { return err }
+
+	j, err := newJob(src, mimetype, w, h, format, o)
+	if err != nil { return err }
+
+	if err := prepareInput(j, src); err != nil { return err }
+
+	// Progress is reported from the count, so it starts over along with it
+	// when a failed backend's output is thrown away
+	out := &countWriter{ w: dst, reset: reset, progress: o.progress }
+
+	if isIdentity(j) || o.skipIfMatches && !o.forceReencode && alreadyMatches(src, mimetype, w, h, j.formatOut, o) {
+		r, err := src.reader()
+		if err != nil { return err }
+		defer closeReader(r)
+
+		_, err = io.Copy(out, r)
+		return err
+	}
+
+	cmds, err := getCmds(j)
+	if err != nil { return err }
+
+	return runCmds(cmds, j, src, out)
+}
+
+// streamable checks whether j only needs to read its input once, so that it
+// can be passed straight through to the backend. The timing of GIFs is put
+// back from the input afterwards, and ICNS output needs the input's size
+func streamable(j *job) bool {
+	return !(j.formatIn == "gif" && j.formatOut == "gif") && j.formatOut != "icns"
+}
+
+// countWriter counts the bytes written through it, so that a failed backend's
+// output can be thrown away before trying another
+type countWriter struct {
+	w        io.Writer
+	n        int64
+	reset    func() // Empties w, nil if it can't be
+	progress func(written int64) // Told the count after every write, if set
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if c.progress != nil { c.progress(c.n) }
+
+	return n, err
+}
+
+// rewind throws away everything written so far, returning false if that
+// isn't possible
+func (c *countWriter) rewind() bool {
+	if c.n == 0 { return true }
+	if c.reset == nil { return false }
+
+	c.reset()
+	c.n = 0
+	if c.progress != nil { c.progress(0) }
+
+	return true
+}
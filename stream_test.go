@@ -0,0 +1,110 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProgressAfterFallback(t *testing.T) {
+	fakePrograms(t, map[string]string{
+		"rsvg-convert": "cat >/dev/null; printf partial; exit 1",
+		"convert":      "cat >/dev/null; printf done",
+	})
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.png"))
+	if err != nil { t.Fatal(err) }
+	defer f.Close()
+
+	var mu sync.Mutex
+	var reports []int64
+	progress := func(written int64) {
+		mu.Lock()
+		reports = append(reports, written)
+		mu.Unlock()
+	}
+
+	err = ConvertToFile(strings.NewReader(testSVG), f, -1, -1, "png", WithProgress(progress))
+	if err != nil { t.Fatal(err) }
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil { t.Fatal(err) }
+	if string(b) != "done" { t.Errorf("file holds %q, want only the output of convert", b) }
+
+	if len(reports) == 0 { t.Fatal("no progress was reported") }
+	if last := reports[len(reports)-1]; last != int64(len(b)) {
+		t.Errorf("last reported %d bytes written, want %d", last, len(b))
+	}
+}
+
+// zeros reads as endless 0 bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+
+	return len(p), nil
+}
+
+func TestLargeTiffMemory(t *testing.T) {
+	if testing.Short() { t.Skip("writes a large file") }
+
+	const size = 64 << 20
+
+	// Stands in for ImageMagick, reading the whole input from the file it's
+	// given and writing a JPEG just as large
+	fakePrograms(t, map[string]string{
+		"convert": `[ "$1" = -list ] && exit; for arg; do case $arg in /*) cat "$arg" >/dev/null;; esac; done; head -c ` + strconv.Itoa(size) + ` /dev/zero`,
+	})
+
+	// Only the header of the TIFF matters, the rest is padding
+	in := io.MultiReader(bytes.NewReader([]byte("II*\x00\x08\x00\x00\x00")), io.LimitReader(zeros{}, size))
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	out := &countWriter{ w: ioutil.Discard }
+	err := ConvertStream(in, out, -1, -1, "jpg", WithStreamingInput())
+	if err != nil { t.Fatal(err) }
+
+	runtime.ReadMemStats(&after)
+
+	if out.n != size { t.Errorf("wrote %d bytes, want %d", out.n, size) }
+
+	// Everything allocated along the way, not only what's still in use, so
+	// buffering either the input or the output would show
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Errorf("allocated %d bytes converting %d, want it bounded", allocated, size)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Converts SVGs to SVGs by editing the size of the root element, keeping the
+// vector data exactly as it was. Rendering them with rsvg-convert or Inkscape
+// instead rewrites the whole file, which can lose things along the way
+var svgConverter = &converter{
+	name:       "svg",
+	inFormats:  []string{ "svg" },
+	outFormats: []string{ "svg" },
+	supports: func(j *job) bool {
+		return !j.opts.forceRender && !j.opts.needsMagick() && !j.opts.needsBackend()
+	},
+	convert: resizeSvg,
+}
+
+// resizeSvg sets the width and height of the root element of an SVG to fit
+// within the resolution of j, leaving the rest of the file untouched
+func resizeSvg(j *job, r io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(r)
+	if err != nil { return nil, err }
+
+	// Nothing to change at the native resolution
+	if j.w <= 0 || j.h <= 0 { return b, nil }
+
+	start, end, root, err := findSvgRoot(b)
+	if err != nil { return nil, err }
+
+	// Keep the aspect ratio the same as every other backend would
+	w, h := j.w, j.h
+	if j.opts.resize != ResizeStretch && j.svgW > 0 && j.svgH > 0 {
+		w, h = fitSize(j.svgW, j.svgH, j.w, j.h)
+	}
+
+	hasViewBox := false
+	for _, attr := range root.Attr {
+		if attr.Name.Space == "" && attr.Name.Local == "viewBox" { hasViewBox = true }
+	}
+
+	// Without a viewBox, changing the size would crop the drawing instead of
+	// scaling it, so add one covering the original size
+	if !hasViewBox {
+		if j.svgW <= 0 || j.svgH <= 0 {
+			return nil, errors.New("svg: unable to resize an SVG with no viewBox or size")
+		}
+
+		root.Attr = append(root.Attr, xml.Attr{
+			Name:  xml.Name{ Local: "viewBox" },
+			Value: "0 0 " + strconv.Itoa(j.svgW) + " " + strconv.Itoa(j.svgH),
+		})
+	}
+
+	// Otherwise the drawing is fit within the new size rather than stretched
+	// to it
+	if j.opts.resize == ResizeStretch {
+		root.Attr = setAttr(root.Attr, "preserveAspectRatio", "none")
+	}
+
+	root.Attr = setAttr(root.Attr, "width", strconv.Itoa(w))
+	root.Attr = setAttr(root.Attr, "height", strconv.Itoa(h))
+
+	selfClosing := bytes.HasSuffix(b[start:end], []byte("/>"))
+
+	var out bytes.Buffer
+	out.Write(b[:start])
+	writeStartTag(&out, root, selfClosing)
+	out.Write(b[end:])
+
+	return out.Bytes(), nil
+}
+
+// findSvgRoot finds the root <svg> element of an SVG, returning where its
+// start tag begins and ends. Namespace prefixes are left as written
+func findSvgRoot(b []byte) (int, int, xml.StartElement, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+
+	for {
+		start := int(d.InputOffset())
+
+		tok, err := d.RawToken()
+		if err != nil { return 0, 0, xml.StartElement{}, errors.New("svg: no root element found") }
+
+		if el, ok := tok.(xml.StartElement); ok {
+			if el.Name.Local != "svg" {
+				return 0, 0, el, errors.New("svg: root element isn't <svg>")
+			}
+
+			return start, int(d.InputOffset()), el.Copy(), nil
+		}
+	}
+}
+
+// setAttr sets an unprefixed attribute, adding it if it isn't already there
+func setAttr(attrs []xml.Attr, name string, value string) []xml.Attr {
+	for i := range attrs {
+		if attrs[i].Name.Space == "" && attrs[i].Name.Local == name {
+			attrs[i].Value = value
+			return attrs
+		}
+	}
+
+	return append(attrs, xml.Attr{ Name: xml.Name{ Local: name }, Value: value })
+}
+
+// writeStartTag writes el as a start tag, keeping the prefixes of its name and
+// attributes as they are
+func writeStartTag(w *bytes.Buffer, el xml.StartElement, selfClosing bool) {
+	w.WriteString("<" + qualifiedName(el.Name))
+
+	for _, attr := range el.Attr {
+		w.WriteString(" " + qualifiedName(attr.Name) + "=\"")
+		xml.EscapeText(w, []byte(attr.Value))
+		w.WriteString("\"")
+	}
+
+	if selfClosing {
+		w.WriteString("/>")
+	} else {
+		w.WriteString(">")
+	}
+}
+
+func qualifiedName(n xml.Name) string {
+	if n.Space == "" { return n.Local }
+
+	return n.Space + ":" + n.Local
+}
+
+// applyAspectRatio makes the resize follow the preserveAspectRatio attribute
+// of the root element of an SVG, unless the caller chose how to resize: meet
+// fits the image within the resolution and slice fills it, with the alignment
+// used as the gravity. none, which stretches the image, is treated as meet
+func applyAspectRatio(src *source, o *options) {
+	r, err := src.reader()
+	if err != nil { return }
+	defer closeReader(r)
+
+	d := xml.NewDecoder(r)
+	d.Strict = false
+
+	var value string
+	for {
+		tok, err := d.RawToken()
+		if err != nil { return }
+
+		if el, ok := tok.(xml.StartElement); ok {
+			for _, attr := range el.Attr {
+				if attr.Name.Space == "" && attr.Name.Local == "preserveAspectRatio" { value = attr.Value }
+			}
+			break
+		}
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) > 0 && fields[0] == "defer" { fields = fields[1:] }
+	if len(fields) == 0 { return }
+
+	if !o.resizeSet && len(fields) > 1 && fields[1] == "slice" {
+		o.resize = ResizeFill
+	}
+
+	if o.gravity == "" {
+		o.gravity = alignGravity(fields[0])
+	}
+}
+
+// alignGravity converts an SVG alignment (eg: xMinYMax) to a gravity (eg:
+// SouthWest), returning an empty string for anything unknown
+func alignGravity(align string) string {
+	if len(align) != 8 || align[0] != 'x' || align[4] != 'Y' { return "" }
+
+	ns := map[string]string{ "Min": "North", "Mid": "", "Max": "South" }[align[5:]]
+	ew := map[string]string{ "Min": "West",  "Mid": "", "Max": "East" }[align[1:4]]
+
+	if ns+ew == "" { return "Center" }
+
+	return ns + ew
+}
@@ -0,0 +1,98 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"io"
+	"os"
+)
+
+// ConvertTee does the same as ConvertStream, but returns a reader of the
+// converted image that also copies it to cache as it's read, such as for
+// passing it on to a client while keeping it on disk for the next one. The
+// conversion goes at the pace it's read, so nothing is buffered on top of
+// what the backend does. Closing the reader before reaching the end (eg: the
+// client disconnected) abandons the conversion, as does it failing, in which
+// case the cache is thrown away: an *os.File is truncated back to where it
+// was, and a writer with a Reset method (eg: *bytes.Buffer) is reset. Other
+// writers are left as they are, so it's up to the caller to throw away what
+// was written when reading doesn't end in io.EOF. Close waits for the
+// conversion to stop, so the cache isn't touched after it returns
+func ConvertTee(data io.Reader, cache io.Writer, w int, h int, format string, opts ...Option) io.ReadCloser {
+	pr, pw := io.Pipe()
+	t := &teeReader{ r: pr, done: make(chan struct{}) }
+
+	reset := cacheReset(cache)
+
+	go func() {
+		defer close(t.done)
+
+		err := checkRes(w, h)
+
+		var o *options
+		if err == nil { o, err = getOptions(opts) }
+
+		// The client is written to first, so a chunk it never got doesn't
+		// make it into the cache either
+		if err == nil {
+			err = convertStream(data, io.MultiWriter(pw, cache), nil, w, h, format, o)
+		}
+
+		if err != nil && reset != nil { reset() }
+
+		pw.CloseWithError(err)
+	}()
+
+	return t
+}
+
+// cacheReset returns a func throwing away what was written to cache by
+// ConvertTee, nil if there's no way to
+func cacheReset(cache io.Writer) func() {
+	switch c := cache.(type) {
+	case *os.File:
+		return fileReset(c)
+	case interface{ Reset() }:
+		return c.Reset
+	}
+
+	return nil
+}
+
+// teeReader reads the output of ConvertTee
+type teeReader struct {
+	r    *io.PipeReader
+	done chan struct{} // Closed once the conversion has stopped
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	return t.r.Read(p)
+}
+
+// Close stops the conversion if it's still going, waiting for it to finish
+// up with the cache
+func (t *teeReader) Close() error {
+	t.r.Close()
+	<-t.done
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"path/filepath"
+)
+
+// GPU texture formats are written with the tools made for them, DirectXTex's
+// texconv for DDS and KTX-Software's toktx for KTX, as ImageMagick can only
+// write DDS with the older block compression formats, and KTX not at all.
+// Like the other codecs, they're only used when there's nothing to do besides
+// changing the format
+var (
+	texconvConverter = &converter{
+		name:        "texconv",
+		args:        texconvArgs,
+		supports:    codecSupports,
+		files:       true,
+		namesOutput: true,
+		inFormats:   []string{ "png", "jpg", "bmp", "tga", "tiff", "hdr" },
+		outFormats:  []string{ "dds" },
+	}
+
+	// toktx has no block compression formats, so it's left to texconv and
+	// ImageMagick when one is asked for
+	toktxConverter = &converter{
+		name:       "toktx",
+		args:       toktxArgs,
+		files:      true,
+		inFormats:  []string{ "png", "jpg" },
+		outFormats: []string{ "ktx", "ktx2" },
+		supports: func(j *job) bool {
+			return j.opts.blockFormat == "" && codecSupports(j)
+		},
+	}
+)
+
+// Block compression formats accepted by WithBlockCompression, along with the
+// names texconv and ImageMagick give them. ImageMagick can't write BC7
+var blockFormats = map[string]struct {
+	texconv string
+	magick  string
+}{
+	"BC1": { "BC1_UNORM", "dxt1" },
+	"BC3": { "BC3_UNORM", "dxt5" },
+	"BC7": { "BC7_UNORM", "" },
+}
+
+// texconv only takes a directory to write to, naming the output after the
+// input
+func texconvArgs(j *job) []string {
+	args := []string{
+		"-nologo", "-y",
+		"-ft", "dds",
+		"-o", filepath.Dir(j.output),
+	}
+
+	if f, ok := blockFormats[j.opts.blockFormat]; ok {
+		args = append(args, "-f", f.texconv)
+	}
+
+	return append(args, j.input)
+}
+
+func toktxArgs(j *job) []string {
+	var args []string
+	if j.formatOut == "ktx2" { args = append(args, "--t2") }
+
+	return append(args, j.output, j.input)
+}
@@ -0,0 +1,81 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// ErrNothingToTrim is returned when trimming an image that's entirely one
+// color, which would leave nothing behind
+var ErrNothingToTrim = errors.New("image is a single color, trimming would leave nothing")
+
+// trim crops img to the smallest area containing every pixel that differs
+// from the top left one by more than fuzz percent, like ImageMagick's -trim
+func trim(img image.Image, fuzz float64) (image.Image, error) {
+	src := toNRGBA(img)
+	b := src.Bounds()
+	if b.Empty() { return nil, ErrNothingToTrim }
+
+	bg := premultiply(src.Pix[0:4])
+	limit := fuzz / 100
+
+	area := image.Rectangle{}
+	for y := 0; y < b.Dy(); y++ {
+		row := src.Pix[y*src.Stride:]
+
+		for x := 0; x < b.Dx(); x++ {
+			p := premultiply(row[x*4 : x*4+4])
+
+			// Colors are compared by their distance in RGBA space, normalized
+			// so the furthest apart two colors can be is 1
+			var dist float64
+			for c := range p {
+				d := p[c] - bg[c]
+				dist += d * d
+			}
+
+			if math.Sqrt(dist/4) <= limit { continue }
+
+			area = area.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+
+	if area.Empty() { return nil, ErrNothingToTrim }
+
+	return src.SubImage(area), nil
+}
+
+// premultiply returns an NRGBA pixel as premultiplied colors from 0 to 1, so
+// fully transparent pixels compare the same no matter their color
+func premultiply(p []uint8) [4]float64 {
+	a := float64(p[3]) / 255
+
+	return [4]float64{
+		float64(p[0]) / 255 * a,
+		float64(p[1]) / 255 * a,
+		float64(p[2]) / 255 * a,
+		a,
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// ErrCorrupt is returned by Validate when an image can't be fully decoded
+var ErrCorrupt = errors.New("image appears truncated or corrupt")
+
+// Validate does a cheap integrity check of an image, meant to be run on
+// untrusted uploads before converting them. The file magic must be that of an
+// image, and formats Go can decode by itself (PNG, JPEG, GIF and SVG) are
+// decoded in full, returning an error wrapping ErrCorrupt if that fails
+func Validate(data io.Reader) error {
+	mimetype, src, err := readInput(data, &options{})
+	defer src.remove()
+	if err != nil { return err }
+
+	r, err := src.reader()
+	if err != nil { return err }
+	defer closeReader(r)
+
+	switch mimetype {
+	case "png", "jpg":
+		_, _, err = image.Decode(r)
+	case "gif":
+		// Check every frame, not just the first
+		_, err = gif.DecodeAll(r)
+	case "svg":
+		err = checkXML(r)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	return nil
+}
+
+// checkXML reads through an entire XML document, making sure it's well formed
+func checkXML(r io.Reader) error {
+	d := xml.NewDecoder(r)
+
+	for {
+		_, err := d.Token()
+		if err == io.EOF { return nil }
+		if err != nil { return err }
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"strconv"
+)
+
+// Video formats ffmpeg can take a frame from. These aren't images, so they're
+// only accepted by the functions that convert to a single image
+var videoFormats = []string{
+	"mp4", "m4v", "webm", "mkv", "mov", "avi", "mpeg", "3gp", "flv", "ogv",
+}
+
+// Takes a representative frame out of videos (and animated GIFs, if nothing
+// else can read them), picked by ffmpeg's thumbnail filter so it's less
+// likely to be a black or blurry frame from a transition. Videos often can't
+// be read from a pipe (MP4s may have their index at the end), so it's given
+// files
+var ffmpegConverter = &converter{
+	name:       "ffmpeg",
+	args:       ffmpegArgs,
+	supports:   renderOnly,
+	files:      true,
+	inFormats:  append([]string{ "gif" }, videoFormats...),
+	outFormats: []string{ "png", "jpg", "bmp", "tiff", "webp", "gif" },
+}
+
+func ffmpegArgs(j *job) []string {
+	filter := "thumbnail"
+	if j.w > 0 && j.h > 0 {
+		filter += ",scale=" + strconv.Itoa(j.w) + ":" + strconv.Itoa(j.h)
+
+		if j.opts.resize != ResizeStretch {
+			filter += ":force_original_aspect_ratio=decrease"
+		}
+	}
+
+	return []string{
+		"-hide_banner", "-loglevel", "error",
+		"-i", j.input,
+		"-vf", filter,
+		"-frames:v", "1",
+		"-y", j.output,
+	}
+}
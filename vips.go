@@ -0,0 +1,67 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package imgconv
+
+import (
+	"strconv"
+)
+
+// libvips' vipsthumbnail picks the part of the image to keep when filling by
+// what draws the eye (faces, skin and saturated or busy areas), which
+// ImageMagick has no equivalent of. It's only used for WithSmartCrop, as
+// ImageMagick's center crop is fallen back on without it
+var vipsConverter = &converter{
+	name:       "vipsthumbnail",
+	args:       vipsArgs,
+	supports:   vipsSupports,
+	files:      true,
+	inFormats:  []string{ "png", "jpg", "gif", "webp", "tiff" },
+	outFormats: []string{ "png", "jpg", "webp", "tiff" },
+}
+
+// vipsSupports checks that j is a smart crop to a resolution, and that there's
+// nothing else vipsthumbnail would have to do
+func vipsSupports(j *job) bool {
+	if !j.opts.smartCrop || j.opts.resize != ResizeFill || j.w <= 0 || j.h <= 0 || j.cmyk {
+		return false
+	}
+
+	o := *j.opts
+	o.resize = ResizeFit
+
+	return !o.needsMagick() && !o.needsBackend() && !o.tunesJpeg(j.formatOut)
+}
+
+func vipsArgs(j *job) []string {
+	// Save options are given in brackets after the output filename
+	output := j.output
+	if j.opts.quality > 0 && (j.formatOut == "jpg" || j.formatOut == "webp") {
+		output += "[Q=" + strconv.Itoa(j.opts.quality) + "]"
+	}
+
+	return []string{
+		j.input,
+		"-s", strconv.Itoa(j.w) + "x" + strconv.Itoa(j.h),
+		"--smartcrop", "attention",
+		"-o", output,
+	}
+}
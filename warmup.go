@@ -0,0 +1,108 @@
+// Copyright © 2021 Mathew Gordon <github.com/mgord9518>
+//
+// Permission  is hereby  granted,  free of charge,  to any person  obtaining a
+// copy of this software  and associated documentation files  (the “Software”),
+// to   deal   in   the  Software   without  restriction,   including   without
+// limitation the rights  to use, copy, modify, merge,   publish,   distribute,
+// sublicense,  and/or sell copies of  the Software, and to  permit  persons to
+// whom  the   Software  is  furnished  to  do  so,  subject  to  the following
+// conditions:
+// 
+// The  above  copyright notice  and this permission notice  shall be  included
+// in  all  copies  or substantial portions of the Software.
+// 
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY  OF ANY KIND,  EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED  TO  THE WARRANTIES  OF  MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE  AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS  OR COPYRIGHT  HOLDERS  BE  LIABLE FOR ANY CLAIM,  DAMAGES  OR OTHER
+// LIABILITY, WHETHER IN  AN  ACTION OF CONTRACT, TORT  OR  OTHERWISE,  ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+
+package imgconv
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Where programs have been found, and the versions they report, so the PATH
+// only has to be searched once. Only programs that were found are kept, so
+// installing one later still gets it picked up
+var (
+	cacheMu      sync.Mutex
+	pathCache    = make(map[string]string)
+	versionCache = make(map[string]string)
+)
+
+// findProgram returns the full path of the program called name, searching
+// the PATH the first time it's asked for
+func findProgram(name string) (string, error) {
+	cacheMu.Lock()
+	path, ok := pathCache[name]
+	cacheMu.Unlock()
+	if ok { return path, nil }
+
+	path, err := lookPath(name)
+	if err != nil { return "", err }
+
+	cacheMu.Lock()
+	pathCache[name] = path
+	cacheMu.Unlock()
+
+	return path, nil
+}
+
+// cachedVersion is programVersion, only running the program the first time
+func cachedVersion(path string, flag string) (string, error) {
+	cacheMu.Lock()
+	version, ok := versionCache[path]
+	cacheMu.Unlock()
+	if ok { return version, nil }
+
+	version, err := programVersion(path, flag)
+	if err != nil { return "", err }
+
+	cacheMu.Lock()
+	versionCache[path] = version
+	cacheMu.Unlock()
+
+	return version, nil
+}
+
+// WarmUp searches for every program imgconv can use and runs each one found
+// to get its version (and ImageMagick to list the formats it supports), so
+// that cost is paid up front (eg: when a service starts) rather than by the
+// first conversion. An error means an installed program failed to run, which
+// would otherwise only show up once it's used. It's safe to call any number
+// of times, from any goroutine, and stops early if ctx is done
+func WarmUp(ctx context.Context) error {
+	var errs []string
+
+	for _, p := range programs {
+		if err := ctx.Err(); err != nil { return err }
+
+		path, err := findProgram(p.name)
+		if err != nil { continue }
+
+		if _, err := cachedVersion(path, p.versionFlag); err != nil {
+			errs = append(errs, p.name+": "+err.Error())
+			continue
+		}
+
+		if p.name == "convert" || p.name == "magick" {
+			if _, err := listMagickFormats(path); err != nil {
+				errs = append(errs, p.name+": "+err.Error())
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New("installed programs failed to run: " + strings.Join(errs, "; "))
+	}
+
+	return nil
+}